@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// accountsCmd represents the accounts command
+var accountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "Manages the names of the AWS accounts",
+	Long:  `Manages the names of the AWS accounts shown when selecting a role`,
+}
+
+func init() {
+	rootCmd.AddCommand(accountsCmd)
+}
@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+// accountsSyncCmd represents the accounts sync command
+var accountsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Caches the names of the AWS accounts",
+	Long: `Caches the names of the AWS accounts, so roles are shown as "alias (account id) / role" when selecting one.
+The accounts of the organization are listed when the jump role can call organizations:ListAccounts. Otherwise, the alias of each account is read with iam:ListAccountAliases.
+Names found by earlier syncs are kept. Log in before syncing. Names set in account_aliases of the config file take precedence`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.AccountsSync(cmd.Context())
+	},
+}
+
+func init() {
+	accountsCmd.AddCommand(accountsSyncCmd)
+}
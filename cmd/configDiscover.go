@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+)
+
+var discoverOptions types.DiscoverOptions
+
+// configDiscoverCmd represents the config discover command
+var configDiscoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Creates profiles for the roles you have access to",
+	Long: `Logs in once with the profile and creates a profile for each selected role of the SAML response.
+The new profiles log in like the profile. Their names come from the name template, which can use {{.Alias}}, {{.Account}}, {{.Role}} and {{.Base}}, the name of the profile.
+With --organization, a role with the name given by --role-name in every account of the organization is offered too, assumed through the jump role`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.ConfigDiscover(cmd.Context(), configuration.Profile, configuration, discoverOptions)
+	},
+}
+
+func init() {
+	configDiscoverCmd.Flags().StringVar(&discoverOptions.NameTemplate, "name-template", internal.DefaultDiscoverNameTemplate, "The template of the names of the new profiles")
+	configDiscoverCmd.Flags().BoolVar(&discoverOptions.Organization, "organization", false, "Also offer a role in every account of the organization, listed with the jump role")
+	configDiscoverCmd.Flags().StringVar(&discoverOptions.RoleName, "role-name", "OrganizationAccountAccessRole", "The role to use in the accounts of the organization")
+	configDiscoverCmd.Flags().BoolVar(&discoverOptions.Overwrite, "overwrite", false, "Replace the profiles that already exist")
+	configCmd.AddCommand(configDiscoverCmd)
+}
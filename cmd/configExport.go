@@ -1,18 +1,26 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/vahid-haghighat/awsure/cmd/internal"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var exportPath string
+var exportOptions types.ExportOptions
 
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Exports config file",
-	Long:  `Exports config file`,
+	Long: `Exports config file. With --format, the profiles are written for aws-azure-login, saml2aws or gimme-aws-creds instead,
+with the values they inherit. An existing file of those tools, like ~/.aws/config, is only changed with --force: it's backed up
+and only the keys awsure writes are updated, keeping every other section and key. With --share, the config is exported for
+others to import: usernames are replaced with placeholders, which importing asks for, and personal settings like remember_me,
+the browser settings and the credentials of the proxy are left out`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var err error
 		exportPath, err = absolutePath(exportPath)
@@ -20,7 +28,7 @@ var exportCmd = &cobra.Command{
 			return err
 		}
 
-		return internal.ConfigExport(exportPath)
+		return internal.ConfigExport(exportPath, exportOptions)
 	},
 }
 
@@ -30,6 +38,10 @@ func init() {
 		command.Parent().HelpFunc()(command, strings)
 	})
 	exportCmd.Flags().StringVarP(&exportPath, "file", "f", "", "The path to export the config file to")
+	exportCmd.Flags().StringVar(&exportOptions.Format, "format", "", fmt.Sprintf("The tool to export for: %s", strings.Join(internal.ConfigFormats(), ", ")))
+	exportCmd.Flags().BoolVar(&exportOptions.Share, "share", false, "Export a config for others to import, without personal values")
+	exportCmd.Flags().StringSliceVar(&exportOptions.Profiles, "profiles", nil, "The profiles to export, with the blocks they inherit from")
+	exportCmd.Flags().BoolVar(&exportOptions.Force, "force", false, "Update the profiles of an existing file of another tool, after backing it up")
 	_ = exportCmd.MarkFlagRequired("file")
 	configCmd.AddCommand(exportCmd)
 }
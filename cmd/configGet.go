@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]...",
+	Short: "Prints values of a profile",
+	Long:  `Prints values of a profile, including the ones it inherits. Without keys, prints every value that's set as YAML`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.ConfigGet(configuration.Profile, args)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+}
@@ -1,25 +1,42 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/vahid-haghighat/awsure/cmd/internal"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"strings"
 )
 
 var importPath string
+var importOptions types.ImportOptions
 
 // importCmd represents the import command
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Imports configurations from config file",
-	Long:  `Imports configurations from config file`,
+	Long: `Imports configurations from config file. The file can also be an https url, or a git repository like
+git::https://github.com/org/repo.git//path/to/awsure.yml?ref=main, which defaults to awsure.yml at the root of the repository.
+With --format, the config of aws-azure-login (~/.aws/config), saml2aws (~/.saml2aws) or gimme-aws-creds (~/.okta_aws_login_config)
+is converted. Without --merge, the config file is replaced.
+With --merge, the imported file is merged into the config file: what only one of them has is kept, and values that differ are
+kept (keep-local), replaced (take-incoming) or chosen one by one (prompt). The config file is backed up before it's changed`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var err error
-		importPath, err = absolutePath(importPath)
-		if err != nil {
-			return err
+		if !internal.IsRemoteSource(importPath) {
+			var err error
+			importPath, err = absolutePath(importPath)
+			if err != nil {
+				return err
+			}
 		}
 
-		return internal.ConfigImport(importPath)
+		return internal.ConfigImport(cmd.Context(), importPath, importOptions, configuration)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(importOptions.Profiles) > 0 && importOptions.Merge == "" {
+			return fmt.Errorf("importing some profiles replaces the rest. use --merge with --profiles")
+		}
+		return nil
 	},
 }
 
@@ -28,7 +45,11 @@ func init() {
 		hideFlagsExcept(rootCmd)
 		command.Parent().HelpFunc()(command, strings)
 	})
-	importCmd.Flags().StringVarP(&importPath, "file", "f", "", "Path to the config file")
+	importCmd.Flags().StringVarP(&importPath, "file", "f", "", "Path, https url or git repository of the config file")
+	importCmd.Flags().StringVar(&importOptions.Format, "format", "", fmt.Sprintf("The tool the file is from: %s", strings.Join(internal.ConfigFormats(), ", ")))
+	importCmd.Flags().StringVar(&importOptions.Merge, "merge", "", fmt.Sprintf("Merge into the config file instead of replacing it. Values that differ are resolved with %s", strings.Join(internal.MergeStrategies, ", ")))
+	importCmd.Flags().BoolVar(&importOptions.DryRun, "dry-run", false, "Print what would change without changing the config file")
+	importCmd.Flags().StringSliceVar(&importOptions.Profiles, "profiles", nil, "The profiles to import, with the blocks they inherit from. Needs --merge")
 	_ = importCmd.MarkFlagRequired("file")
 	configCmd.AddCommand(importCmd)
 }
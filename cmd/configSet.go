@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+var setFromFile string
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set [key=value]...",
+	Short: "Sets values of a profile",
+	Long: `Sets values of a profile without prompting, using the keys of the config file, like destination_account_id=123456789012.
+Lists, like browser_args, are separated by commas. With --from-file, the values are read from a JSON or YAML file of keys and values.
+The profile is created when it doesn't exist`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := setFromFile
+		if path != "" {
+			var err error
+			path, err = absolutePath(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		return internal.ConfigSet(configuration.Profile, args, path)
+	},
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && setFromFile == "" {
+			return fmt.Errorf("give key=value pairs or a file with --from-file")
+		}
+		return nil
+	},
+}
+
+func init() {
+	configSetCmd.Flags().StringVar(&setFromFile, "from-file", "", "A JSON or YAML file of keys and values to set")
+	configCmd.AddCommand(configSetCmd)
+}
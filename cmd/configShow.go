@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+var showResolved bool
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Shows a profile",
+	Long: `Shows the values a profile sets in the config file. With --resolved, shows the values a login would use and where each one came from:
+the built-in defaults, the config file, AWSURE_* environment variables or the command line flags, which take precedence in that order`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.ConfigShow(configuration.Profile, showResolved, configuration)
+	},
+}
+
+func init() {
+	configShowCmd.Flags().BoolVar(&showResolved, "resolved", false, "Show the values a login would use and where they came from")
+	configCmd.AddCommand(configShowCmd)
+}
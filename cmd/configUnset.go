@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+// configUnsetCmd represents the config unset command
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset key...",
+	Short: "Removes values from a profile",
+	Long:  `Removes values from a profile. Values the profile inherits apply again`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return internal.ConfigUnset(configuration.Profile, args)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configUnsetCmd)
+}
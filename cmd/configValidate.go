@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+var validatePath string
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the config file",
+	Long: `Checks the values of the config file, like tenant ids, account ids, role names, durations and regions, and flags unknown keys with their line numbers.
+Fails when the file has errors`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := validatePath
+		if path != "" {
+			var err error
+			path, err = absolutePath(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		return internal.ValidateConfig(path)
+	},
+}
+
+func init() {
+	configValidateCmd.Flags().StringVarP(&validatePath, "file", "f", "", "The config file to check. Defaults to the config file of awsure")
+	configCmd.AddCommand(configValidateCmd)
+}
@@ -0,0 +1,289 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfg "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultAccountsRegion = "us-east-1"
+
+// AccountsSync finds the names of the accounts the logged in jump roles and
+// profiles can see, and caches them for the role picker. It lists the accounts
+// of the organization when the jump role is allowed to, and reads the account
+// alias of each account otherwise.
+func AccountsSync(ctx context.Context) error {
+	configs, err := loadConfigs()
+	if err != nil {
+		return err
+	}
+
+	jumpRoles, err := loadJumpRoleCredentials()
+	if err != nil {
+		return fmt.Errorf("there are no jump role credentials. please log in first")
+	}
+
+	aliases := make(map[string]string)
+	now := time.Now()
+
+	for jumpRoleArn, jumpRole := range jumpRoles {
+		if jumpRole == nil || !jumpRole.AwsExpiration.After(now) {
+			continue
+		}
+
+		awsConfig, err := staticCredentialsConfig(ctx, jumpRole.AwsAccessKeyId, jumpRole.AwsSecretAccessKey, jumpRole.AwsSessionToken, jumpRoleRegion(configs, jumpRoleArn))
+		if err != nil {
+			return err
+		}
+
+		accounts, err := organizationAccounts(ctx, awsConfig)
+		if err == nil {
+			for id, name := range accounts {
+				aliases[id] = name
+			}
+			continue
+		}
+
+		accountId := accountIdFromArn(jumpRoleArn)
+		if accountId == "" || aliases[accountId] != "" {
+			continue
+		}
+		alias, err := accountAlias(ctx, awsConfig)
+		if err != nil {
+			warn("couldn't read the alias of %s with %s: %v", accountId, jumpRoleArn, err)
+			continue
+		}
+		if alias != "" {
+			aliases[accountId] = alias
+		}
+	}
+
+	awsCredentials, err := ini.Load(defaultAwsCredentialsFileLocation)
+	if err == nil {
+		for profile, config := range configs {
+			if config.DestinationAccountId == "" || aliases[config.DestinationAccountId] != "" {
+				continue
+			}
+
+			section, err := awsCredentials.GetSection(profile)
+			if err != nil {
+				continue
+			}
+			expiration, err := time.Parse(timeFormat, section.Key("aws_expiration").String())
+			if err != nil || !expiration.After(now) {
+				continue
+			}
+
+			awsConfig, err := staticCredentialsConfig(ctx,
+				section.Key("aws_access_key_id").String(),
+				section.Key("aws_secret_access_key").String(),
+				section.Key("aws_session_token").String(),
+				config.Region)
+			if err != nil {
+				return err
+			}
+
+			alias, err := accountAlias(ctx, awsConfig)
+			if err != nil {
+				warn("couldn't read the alias of %s with %s profile: %v", config.DestinationAccountId, profile, err)
+				continue
+			}
+			if alias != "" {
+				aliases[config.DestinationAccountId] = alias
+			}
+		}
+	}
+
+	if len(aliases) == 0 {
+		return fmt.Errorf("couldn't find the name of any account. please log in and make sure the roles can call organizations:ListAccounts or iam:ListAccountAliases")
+	}
+
+	// Accounts only reachable through jump roles that have expired since the
+	// last sync keep their names
+	var cached map[string]string
+	if cache, err := loadAccountAliasesCache(); err == nil {
+		cached = cache.Aliases
+	}
+	merged := mergeAccountAliases(cached, aliases)
+
+	err = saveAccountAliasesCache(merged)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Found the names of %d accounts\n", len(aliases))
+	if kept := len(merged) - len(aliases); kept > 0 {
+		fmt.Printf("Kept the names of %d accounts from earlier syncs\n", kept)
+	}
+	return nil
+}
+
+// mergeAccountAliases returns the cached names with the ones just found, which
+// replace the cached name of the same account
+func mergeAccountAliases(cached map[string]string, found map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for id, alias := range cached {
+		merged[id] = alias
+	}
+	for id, alias := range found {
+		merged[id] = alias
+	}
+	return merged
+}
+
+func staticCredentialsConfig(ctx context.Context, accessKeyId string, secretAccessKey string, sessionToken string, region string) (aws.Config, error) {
+	awsConfig, err := cfg.LoadDefaultConfig(ctx, cfg.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyId, secretAccessKey, sessionToken)))
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if awsConfig.Region == "" {
+		awsConfig.Region = region
+	}
+	if awsConfig.Region == "" {
+		awsConfig.Region = defaultAccountsRegion
+	}
+	return awsConfig, nil
+}
+
+func organizationAccounts(ctx context.Context, awsConfig aws.Config) (map[string]string, error) {
+	client := organizations.NewFromConfig(awsConfig)
+	paginator := organizations.NewListAccountsPaginator(client, &organizations.ListAccountsInput{})
+
+	accounts := make(map[string]string)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, account := range page.Accounts {
+			if account.Id != nil && account.Name != nil {
+				accounts[*account.Id] = *account.Name
+			}
+		}
+	}
+
+	return accounts, nil
+}
+
+func accountAlias(ctx context.Context, awsConfig aws.Config) (string, error) {
+	client := iam.NewFromConfig(awsConfig)
+	result, err := client.ListAccountAliases(ctx, &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+
+	if len(result.AccountAliases) == 0 {
+		return "", nil
+	}
+	return result.AccountAliases[0], nil
+}
+
+func jumpRoleRegion(configs map[string]*configuration, jumpRoleArn string) string {
+	for _, config := range configs {
+		if config.DefaultJumpRole == jumpRoleArn && config.Region != "" {
+			return config.Region
+		}
+	}
+	return ""
+}
+
+// accountAliases returns the names of the accounts, from the cache of
+// `awsure accounts sync` and the account_aliases of the config file, which
+// take precedence
+func accountAliases() map[string]string {
+	aliases := make(map[string]string)
+
+	cache, err := loadAccountAliasesCache()
+	if err == nil {
+		for id, alias := range cache.Aliases {
+			aliases[id] = alias
+		}
+	}
+
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if err == nil {
+		for id, alias := range configFile.AccountAliases {
+			aliases[id] = alias
+		}
+	}
+
+	return aliases
+}
+
+func loadAccountAliasesCache() (*accountAliasesFile, error) {
+	_, err := os.Stat(defaultAccountAliasesLocation)
+	if os.IsNotExist(err) {
+		return nil, fileNotFoundError
+	}
+
+	content, err := os.ReadFile(defaultAccountAliasesLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	file := accountAliasesFile{}
+	err = yaml.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the account names from %s: %v", defaultAccountAliasesLocation, err)
+	}
+	return &file, nil
+}
+
+func saveAccountAliasesCache(aliases map[string]string) error {
+	err := os.MkdirAll(filepath.Dir(defaultAccountAliasesLocation), 0755)
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(accountAliasesFile{
+		Version:  configFileVersion,
+		SyncedAt: time.Now(),
+		Aliases:  aliases,
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(defaultAccountAliasesLocation, content, 0644)
+}
+
+// accountIdFromArn returns the account of an IAM ARN, or an empty string when
+// the ARN isn't valid
+func accountIdFromArn(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return ""
+	}
+	return parts[4]
+}
+
+// roleDisplayName renders a role ARN as "alias (account) / role" when the
+// account has a known name
+func roleDisplayName(roleArn string, aliases map[string]string) string {
+	accountId := accountIdFromArn(roleArn)
+	alias, ok := aliases[accountId]
+	if !ok || alias == "" {
+		return roleArn
+	}
+
+	return fmt.Sprintf("%s (%s) / %s", alias, accountId, roleNameFromArn(roleArn))
+}
+
+// roleNameFromArn returns the name of the role, with its path
+func roleNameFromArn(roleArn string) string {
+	if i := strings.Index(roleArn, ":role/"); i >= 0 {
+		return roleArn[i+len(":role/"):]
+	}
+	return roleArn
+}
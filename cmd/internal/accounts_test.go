@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeAccountAliases(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached map[string]string
+		found  map[string]string
+		want   map[string]string
+	}{
+		{
+			name:  "no cache",
+			found: map[string]string{"123456789012": "prod"},
+			want:  map[string]string{"123456789012": "prod"},
+		},
+		{
+			name:   "accounts that weren't found are kept",
+			cached: map[string]string{"123456789012": "prod", "210987654321": "dev"},
+			found:  map[string]string{"123456789012": "prod"},
+			want:   map[string]string{"123456789012": "prod", "210987654321": "dev"},
+		},
+		{
+			name:   "found names replace cached ones",
+			cached: map[string]string{"123456789012": "old-name"},
+			found:  map[string]string{"123456789012": "prod", "210987654321": "dev"},
+			want:   map[string]string{"123456789012": "prod", "210987654321": "dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeAccountAliases(tt.cached, tt.found); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeAccountAliases() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleDisplayName(t *testing.T) {
+	aliases := map[string]string{"123456789012": "prod"}
+
+	tests := []struct {
+		roleArn string
+		want    string
+	}{
+		{roleArn: "arn:aws:iam::123456789012:role/Admin", want: "prod (123456789012) / Admin"},
+		{roleArn: "arn:aws:iam::123456789012:role/team/Admin", want: "prod (123456789012) / team/Admin"},
+		{roleArn: "arn:aws:iam::210987654321:role/Admin", want: "arn:aws:iam::210987654321:role/Admin"},
+		{roleArn: "not-an-arn", want: "not-an-arn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.roleArn, func(t *testing.T) {
+			if got := roleDisplayName(tt.roleArn, aliases); got != tt.want {
+				t.Errorf("roleDisplayName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"gopkg.in/ini.v1"
+	"strconv"
+	"strings"
+)
+
+const formatAwsAzureLogin = "aws-azure-login"
+
+func init() {
+	registerConfigConverter(formatAwsAzureLogin, &configConverter{
+		defaultFileName: "config",
+		read:            readAwsAzureLogin,
+		write:           writeAwsAzureLogin,
+	})
+}
+
+// readAwsAzureLogin reads the profiles aws-azure-login keeps in ~/.aws/config
+func readAwsAzureLogin(file *ini.File) (map[string]*configuration, error) {
+	configs := make(map[string]*configuration)
+
+	for _, section := range file.Sections() {
+		if !section.HasKey("azure_tenant_id") {
+			continue
+		}
+
+		profile := strings.TrimPrefix(section.Name(), "profile ")
+		config := &configuration{
+			AzureTenantId: section.Key("azure_tenant_id").String(),
+			AzureAppIdUri: section.Key("azure_app_id_uri").String(),
+			AzureUsername: section.Key("azure_default_username").String(),
+			RememberMe:    section.Key("azure_default_remember_me").MustBool(false),
+			Region:        section.Key("region").String(),
+		}
+		if hours := section.Key("azure_default_duration_hours").MustInt(0); hours > 0 {
+			config.DefaultDurationHours = clampHours(hours)
+		}
+		applyRoleArn(config, section.Key("azure_default_role_arn").String())
+
+		if config.AzureAppIdUri == "" {
+			warnMissingValue(profile, "azure_app_id_uri")
+		}
+		configs[profile] = config
+	}
+
+	return configs, nil
+}
+
+func writeAwsAzureLogin(configs map[string]*configuration) (*ini.File, error) {
+	file := ini.Empty()
+
+	for _, profile := range sortedProfiles(configs) {
+		config := configs[profile]
+		if config.Idp == idpOkta {
+			warn("%s logs in to Okta, which %s doesn't support. skipping it", profile, formatAwsAzureLogin)
+			continue
+		}
+
+		name := "profile " + profile
+		if profile == "default" {
+			name = profile
+		}
+		section, err := file.NewSection(name)
+		if err != nil {
+			return nil, err
+		}
+
+		values := [][2]string{
+			{"azure_tenant_id", config.AzureTenantId},
+			{"azure_app_id_uri", config.AzureAppIdUri},
+			{"azure_default_username", config.AzureUsername},
+			{"azure_default_role_arn", exportedRoleArn(profile, config, formatAwsAzureLogin)},
+			{"azure_default_duration_hours", strconv.Itoa(clampHours(config.DefaultDurationHours))},
+			{"azure_default_remember_me", strconv.FormatBool(config.RememberMe)},
+			{"region", config.Region},
+		}
+		for _, value := range values {
+			if value[1] != "" {
+				_, _ = section.NewKey(value[0], value[1])
+			}
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// browserProfileDirectory is the user data directory of the browser for the
+// identity of the configuration, so Azure's cookies survive between logins
+func browserProfileDirectory(conf *configuration) string {
+	return filepath.Join(defaultBrowserProfilesDirectory, conf.Hash()[:32])
+}
+
+// resolveBrowserSettings takes the settings from the configuration, which has
+// the command line flags applied already
+func resolveBrowserSettings(conf *configuration) browserSettings {
+	return browserSettings{
+		path:      conf.BrowserPath,
+		url:       conf.BrowserUrl,
+		args:      conf.BrowserArgs,
+		noSandbox: conf.BrowserNoSandbox,
+		proxy:     conf.Proxy,
+		caBundle:  conf.CaBundle,
+	}
+}
+
+// openBrowser launches a browser or, when a browser url is configured, connects
+// to a running one. The returned cleanup function closes the browser and
+// should be deferred
+func openBrowser(conf *configuration, settings browserSettings, headless bool) (*rod.Browser, func(), error) {
+	if settings.url != "" {
+		warnIgnoredBrowserSettings(settings)
+
+		controlUrl := settings.url
+		parsedUrl, err := url.Parse(controlUrl)
+		if err != nil || !strings.HasPrefix(parsedUrl.Path, "/devtools/") {
+			controlUrl, err = launcher.ResolveURL(settings.url)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to find the browser at %s: %v", settings.url, err)
+			}
+		}
+
+		browser := rod.New().ControlURL(controlUrl)
+		err = browser.Connect()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to the browser at %s: %v", settings.url, err)
+		}
+
+		// The browser may be shared, so every login gets its own incognito
+		// context and closing it leaves the browser running
+		incognito, err := browser.Incognito()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create an incognito context in the browser at %s: %v", settings.url, err)
+		}
+
+		return incognito, func() {
+			_ = incognito.Close()
+		}, nil
+	}
+
+	l, cleanupLauncher, err := newLauncher(conf, settings, headless)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	controlUrl, err := l.Launch()
+	if err != nil {
+		cleanupLauncher()
+		return nil, nil, fmt.Errorf("failed to launch the browser: %v. set browser_path or use --browser-path to use an installed browser", err)
+	}
+
+	browser := rod.New().ControlURL(controlUrl)
+	err = browser.Connect()
+	if err != nil {
+		l.Kill()
+		cleanupLauncher()
+		return nil, nil, fmt.Errorf("failed to connect to the launched browser: %v", err)
+	}
+
+	return browser, func() {
+		_ = browser.Close()
+		cleanupLauncher()
+	}, nil
+}
+
+// warnIgnoredBrowserSettings tells which settings don't apply to a running
+// browser, as they're only used when awsure launches one. The running browser
+// needs them set when it's started
+func warnIgnoredBrowserSettings(settings browserSettings) {
+	var ignored []string
+	if settings.path != "" {
+		ignored = append(ignored, "browser_path")
+	}
+	if len(settings.args) > 0 {
+		ignored = append(ignored, "browser_args")
+	}
+	if settings.noSandbox {
+		ignored = append(ignored, "browser_no_sandbox")
+	}
+	if settings.proxy != "" {
+		ignored = append(ignored, "proxy")
+	}
+	if settings.caBundle != "" {
+		ignored = append(ignored, "ca_bundle")
+	}
+
+	if len(ignored) > 0 {
+		warn("%s only apply to a browser awsure launches, not to the one at %s. start that browser with them instead",
+			strings.Join(ignored, ", "), settings.url)
+	}
+}
+
+// newLauncher prepares the browser launcher. The returned cleanup function
+// waits for the browser to exit and should be deferred before the browser is
+// closed
+func newLauncher(conf *configuration, settings browserSettings, headless bool) (*launcher.Launcher, func(), error) {
+	l := launcher.New().
+		Headless(headless).
+		Devtools(false).
+		NoSandbox(settings.noSandbox).
+		UserDataDir(browserProfileDirectory(conf))
+
+	if settings.path != "" {
+		l = l.Bin(settings.path)
+	}
+
+	for _, arg := range settings.args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if hasValue {
+			l = l.Set(flags.Flag(name), value)
+		} else {
+			l = l.Set(flags.Flag(name))
+		}
+	}
+
+	// Chromium has no flag to add a trusted root, so the keys of the bundle are
+	// pinned instead: certificate errors are ignored for chains that have one
+	// of them. Revocation, expiry and name checks don't apply to those chains
+	if settings.caBundle != "" {
+		certificates, err := loadCaBundle(settings.caBundle)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var publicKeys []crypto.PublicKey
+		for _, certificate := range certificates {
+			publicKeys = append(publicKeys, certificate.PublicKey)
+		}
+
+		err = l.IgnoreCerts(publicKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var forwarder *proxyForwarder
+	if settings.proxy != "" {
+		proxyUrl, err := url.Parse(settings.proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy %s: %v", settings.proxy, err)
+		}
+
+		if proxyUrl.User == nil {
+			l = l.Proxy(fmt.Sprintf("%s://%s", proxyUrl.Scheme, proxyUrl.Host))
+		} else {
+			forwarder, err = startProxyForwarder(proxyUrl, settings.caBundle)
+			if err != nil {
+				return nil, nil, err
+			}
+			l = l.Proxy(forwarder.address())
+		}
+	}
+
+	cleanup := func() {
+		// launcher.Cleanup waits for the browser to exit, which never happens
+		// when it wasn't started. It also removes the user data directory, so
+		// it's unset first to keep the browser profile
+		if l.PID() != 0 {
+			l.UserDataDir("")
+			l.Cleanup()
+		}
+
+		if forwarder != nil {
+			forwarder.close()
+		}
+	}
+
+	return l, cleanup, nil
+}
+
+func loadCaBundle(path string) ([]*x509.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ca bundle: %v", err)
+	}
+
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse a certificate in the ca bundle: %v", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("the ca bundle %s has no certificates", path)
+	}
+
+	return certificates, nil
+}
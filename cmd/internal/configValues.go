@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ConfigSet sets the values of a profile, given as key=value with the keys of
+// the config file, or read from a JSON or YAML file of keys and values. The
+// profile is created when it doesn't exist
+func ConfigSet(profile string, assignments []string, fromFile string) error {
+	values := &yaml.Node{Kind: yaml.MappingNode}
+
+	if fromFile != "" {
+		content, err := os.ReadFile(fromFile)
+		if err != nil {
+			return err
+		}
+
+		document := yaml.Node{}
+		err = yaml.Unmarshal(content, &document)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", fromFile, err)
+		}
+		if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+			return fmt.Errorf("%s should have a mapping of keys to values", fromFile)
+		}
+		values = document.Content[0]
+	}
+
+	for _, assignment := range assignments {
+		key, value, found := strings.Cut(assignment, "=")
+		if !found {
+			return fmt.Errorf("%s should be key=value", assignment)
+		}
+		key = strings.TrimSpace(key)
+
+		field, ok := configurationField(&configuration{}, key)
+		if !ok {
+			return unknownConfigKeyError(key)
+		}
+		values.Content = append(values.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+			valueNode(field.Kind(), value))
+	}
+
+	if len(values.Content) == 0 {
+		return fmt.Errorf("there is nothing to set. please give key=value pairs or a file")
+	}
+
+	// The values are set on the profile as the config file has it, so the
+	// values it inherits stay inherited
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if errors.Is(err, fileNotFoundError) {
+		configFile = &configurationFile{}
+	} else if err != nil {
+		return err
+	}
+	if configFile.Configs == nil {
+		configFile.Configs = make(map[string]*configuration)
+	}
+
+	config, ok := configFile.Configs[profile]
+	if !ok {
+		fmt.Printf("Creating %s profile\n", profile)
+	}
+	if config == nil {
+		config = &configuration{}
+		configFile.Configs[profile] = config
+	}
+
+	var problems []string
+	for _, problem := range valueProblems(values, "configs."+profile) {
+		if problem.severity == problemError {
+			problems = append(problems, fmt.Sprintf("%s: %s", problem.path, problem.message))
+			continue
+		}
+		warn("%s: %s", problem.path, problem.message)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid values:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	for i := 0; i+1 < len(values.Content); i += 2 {
+		key := values.Content[i].Value
+
+		field, ok := configurationField(config, key)
+		if !ok {
+			return unknownConfigKeyError(key)
+		}
+
+		err = values.Content[i+1].Decode(field.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		config.markExplicit(key)
+	}
+
+	// A profile that names blocks that don't exist can't be loaded anymore
+	_, err = configFile.layers(config)
+	if err != nil {
+		return fmt.Errorf("profile %s: %v", profile, err)
+	}
+
+	return saveConfigurationFile(configFile)
+}
+
+// ConfigGet prints the values of a profile, including the inherited ones.
+// Without keys, every value that's set is printed as YAML
+func ConfigGet(profile string, keys []string) error {
+	config, err := loadProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		content, err := yaml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(content))
+		return nil
+	}
+
+	for _, key := range keys {
+		field, ok := configurationField(config, key)
+		if !ok {
+			return unknownConfigKeyError(key)
+		}
+
+		value := field.Interface()
+		if args, ok := value.([]string); ok {
+			value = strings.Join(args, ",")
+		}
+
+		if len(keys) == 1 {
+			fmt.Println(value)
+		} else {
+			fmt.Printf("%s=%v\n", key, value)
+		}
+	}
+
+	return nil
+}
+
+// ConfigShow prints the values the profile sets in the config file. With
+// resolved, it prints the values a login would use instead, with where each
+// one came from
+func ConfigShow(profile string, resolved bool, options types.Configuration) error {
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if err != nil {
+		return err
+	}
+
+	config, ok := configFile.Configs[profile]
+	if !ok {
+		return fmt.Errorf("profile %s does not exist", profile)
+	}
+	if config == nil {
+		config = &configuration{}
+	}
+
+	if !resolved {
+		content, err := yaml.Marshal(config)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(content))
+		return nil
+	}
+
+	layers, err := configFile.layers(config)
+	if err != nil {
+		return fmt.Errorf("profile %s: %v", profile, err)
+	}
+	for i := range layers {
+		layers[i].source = fmt.Sprintf("config file (%s)", layers[i].source)
+	}
+
+	layered, sources, err := layerConfig(layers, options)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "KEY\tVALUE\tSOURCE")
+	for _, key := range yamlKeys(reflect.TypeOf(configuration{})) {
+		source, ok := sources[key]
+		if !ok {
+			continue
+		}
+
+		field, _ := configurationField(layered, key)
+		value := field.Interface()
+		if args, ok := value.([]string); ok {
+			value = strings.Join(args, ",")
+		}
+		_, _ = fmt.Fprintf(writer, "%s\t%v\t%s\n", key, value, source)
+	}
+	return writer.Flush()
+}
+
+// ConfigUnset removes values from a profile. Inherited values apply again
+func ConfigUnset(profile string, keys []string) error {
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if err != nil {
+		return err
+	}
+
+	config, ok := configFile.Configs[profile]
+	if !ok {
+		return fmt.Errorf("profile %s does not exist", profile)
+	}
+	if config == nil {
+		config = &configuration{}
+		configFile.Configs[profile] = config
+	}
+
+	for _, key := range keys {
+		field, ok := configurationField(config, key)
+		if !ok {
+			return unknownConfigKeyError(key)
+		}
+		field.Set(reflect.Zero(field.Type()))
+		config.unmarkExplicit(key)
+	}
+
+	return saveConfigurationFile(configFile)
+}
+
+func loadProfile(profile string) (*configuration, error) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	config, ok := configs[profile]
+	if !ok {
+		return nil, fmt.Errorf("profile %s does not exist", profile)
+	}
+	return config, nil
+}
+
+// configurationField returns the field of the configuration with the yaml key
+func configurationField(config *configuration, key string) (reflect.Value, bool) {
+	value := reflect.ValueOf(config).Elem()
+	t := value.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0] == key {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// valueNode turns a value given on the command line into a node of the kind of
+// the field. Lists are separated by commas
+func valueNode(kind reflect.Kind, value string) *yaml.Node {
+	switch kind {
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return node
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}
+		}
+	case reflect.Int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func unknownConfigKeyError(key string) error {
+	known := yamlKeys(reflect.TypeOf(configuration{}))
+	if suggestion := closestKey(key, known); suggestion != "" {
+		return fmt.Errorf("unknown key %s. did you mean %s?", key, suggestion)
+	}
+	return fmt.Errorf("unknown key %s. the keys are %s", key, strings.Join(known, ", "))
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+const switchIdentityConfig = `version: 1.1.0
+identities:
+  a:
+    idp: azure
+    azure_tenant_id: tenant-a
+    azure_app_id_uri: app-a
+  b:
+    idp: azure
+    azure_tenant_id: tenant-b
+defaults:
+  team:
+    identity: a
+    region: eu-west-1
+configs:
+  prod:
+    identity: a
+    region: us-east-1
+  staging:
+    defaults: team
+  broken:
+    identity: nope
+`
+
+func TestConfigSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     string
+		assignments []string
+		want        configuration
+		wantErr     bool
+	}{
+		{
+			name:        "switching identity doesn't keep the values of the previous one",
+			profile:     "prod",
+			assignments: []string{"identity=b"},
+			want:        configuration{Identity: "b", Region: "us-east-1"},
+		},
+		{
+			name:        "switching defaults doesn't keep the values of the previous ones",
+			profile:     "staging",
+			assignments: []string{"defaults=", "identity=b"},
+			want:        configuration{Identity: "b"},
+		},
+		{
+			name:        "values are set on the profile",
+			profile:     "staging",
+			assignments: []string{"region=eu-central-1", "browser_args=--incognito,--headless"},
+			want:        configuration{Defaults: "team", Region: "eu-central-1", BrowserArgs: []string{"--incognito", "--headless"}},
+		},
+		{
+			name:        "new profiles are created",
+			profile:     "dev",
+			assignments: []string{"identity=b"},
+			want:        configuration{Identity: "b"},
+		},
+		{
+			name:        "identities that don't exist are refused",
+			profile:     "prod",
+			assignments: []string{"identity=c"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := useConfigLocation(t, switchIdentityConfig)
+
+			err := ConfigSet(tt.profile, tt.assignments, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			configFile, err := loadConfigurationFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := *configFile.Configs[tt.profile]
+			got.explicit = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("saved profile = %+v, want %+v", got, tt.want)
+			}
+
+			// Profiles that can't be resolved are kept as they are
+			if broken := configFile.Configs["broken"]; broken == nil || broken.Identity != "nope" {
+				t.Errorf("saved broken profile = %+v", broken)
+			}
+		})
+	}
+}
+
+func TestConfigSetResolvesTheNewIdentity(t *testing.T) {
+	path := useConfigLocation(t, switchIdentityConfig)
+
+	if err := ConfigSet("prod", []string{"identity=b"}, ""); err != nil {
+		t.Fatalf("ConfigSet() error = %v", err)
+	}
+
+	configs, err := loadConfigsFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod := configs["prod"]; prod.AzureTenantId != "tenant-b" || prod.AzureAppIdUri != "" {
+		t.Errorf("resolved prod = %+v, want the tenant of b and no app id uri", prod)
+	}
+}
+
+func TestConfigUnset(t *testing.T) {
+	path := useConfigLocation(t, switchIdentityConfig)
+
+	if err := ConfigUnset("prod", []string{"region"}); err != nil {
+		t.Fatalf("ConfigUnset() error = %v", err)
+	}
+	if err := ConfigUnset("missing", []string{"region"}); err == nil {
+		t.Errorf("ConfigUnset() of a profile that doesn't exist succeeded")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile, err := loadConfigurationFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod := *configFile.Configs["prod"]; prod.Identity != "a" || prod.Region != "" || prod.AzureTenantId != "" {
+		t.Errorf("saved prod = %+v, want only its identity\n%s", prod, content)
+	}
+}
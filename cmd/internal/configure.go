@@ -1,14 +1,16 @@
 package internal
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
 	"gopkg.in/yaml.v3"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
 )
 
 func ConfigAll() error {
@@ -35,77 +37,157 @@ func ConfigAll() error {
 	return saveConfig(configs)
 }
 
+// ConfigProfile asks for the settings of the profile, showing the values it
+// inherits, and saves the ones that were changed
 func ConfigProfile(profile string) error {
-	configs, err := loadConfigs()
 	if profile == "" {
 		profile = "default"
 	}
 
-	if err != nil {
-		if errors.Is(err, fileNotFoundError) {
-			configs = map[string]*configuration{
-				profile: {},
-			}
-		} else {
-			return err
-		}
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if errors.Is(err, fileNotFoundError) {
+		configFile = &configurationFile{}
+	} else if err != nil {
+		return err
+	}
+	if configFile.Configs == nil {
+		configFile.Configs = make(map[string]*configuration)
+	}
+
+	config := configFile.Configs[profile]
+	if config == nil {
+		config = &configuration{}
 	}
 
-	if _, ok := configs[profile]; !ok {
-		configs[profile] = &configuration{}
+	current, err := configFile.resolve(config)
+	if err != nil {
+		return fmt.Errorf("profile %s: %v", profile, err)
 	}
 
-	configs[profile], err = askConfig(*configs[profile], false)
+	answers, err := askConfig(*current, false)
 	if err != nil {
 		return err
 	}
 
-	return saveConfig(configs)
+	config.applyChanges(current, answers)
+	configFile.Configs[profile] = config
+
+	return saveConfigurationFile(configFile)
 }
 
+// ConfigRemove removes the profile from the config file. It works on the file
+// itself, so profiles that can't be resolved can be removed too
 func ConfigRemove(profile string) error {
-	configs, err := loadConfigs()
-	if err != nil {
+	configFile, err := loadConfigurationFile(defaultConfigLocation)
+	if errors.Is(err, fileNotFoundError) {
 		fmt.Println("There is no configuration file present, so you're probably good to go!")
 		return nil
 	}
+	if err != nil {
+		return err
+	}
 
-	if _, ok := configs[profile]; !ok {
+	if _, ok := configFile.Configs[profile]; !ok {
 		fmt.Println("We couldn't find the profile you specified, so you're probably good to go!")
 		return nil
 	}
 
-	delete(configs, profile)
+	delete(configFile.Configs, profile)
 	fmt.Printf("Removed %s profile\n", profile)
 
-	return saveConfig(configs)
+	return saveConfigurationFile(configFile)
 }
 
-func ConfigImport(importPath string) error {
-	stat, err := os.Stat(importPath)
+// ConfigImport imports the config at source, which is a file, an https url or
+// a git repository, in the given format. Without a merge strategy it replaces
+// the config file, otherwise it's merged into it. The config file is backed up
+// first
+func ConfigImport(ctx context.Context, source string, options types.ImportOptions, global types.Configuration) error {
+	if options.Merge != "" && !contains(MergeStrategies, options.Merge) {
+		return fmt.Errorf("unknown merge strategy %s. the strategies are %s", options.Merge, strings.Join(MergeStrategies, ", "))
+	}
+
+	// Remote sources are fetched with the proxy and ca bundle of the flags
+	// and environment variables, as there's no profile to take them from
+	effective, err := effectiveConfig(&configuration{}, global)
 	if err != nil {
 		return err
 	}
 
-	if stat.IsDir() {
-		return fmt.Errorf("%s is a directory. please provide a valid config file", importPath)
+	importPath, cleanup, err := fetchImportSource(ctx, source, resolveBrowserSettings(effective))
+	if err != nil {
+		return err
 	}
+	defer cleanup()
 
-	_, err = os.Stat(defaultConfigLocation)
-	if err == nil {
-		fmt.Println("Backing up existing config file")
-		err = os.Rename(defaultConfigLocation, fmt.Sprintf("%s.bkp", defaultConfigLocation))
+	var incoming *configurationFile
+	if options.Format == "" || options.Format == formatAwsure {
+		incoming, err = loadConfigurationFile(importPath)
+	} else {
+		incoming, err = convertConfigFile(importPath, options.Format)
+	}
+	if err != nil {
+		return err
+	}
+
+	local, err := loadConfigurationFile(defaultConfigLocation)
+	if errors.Is(err, fileNotFoundError) {
+		local = nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(options.Profiles) > 0 {
+		incoming, err = incoming.selectProfiles(options.Profiles, local)
+		if err != nil {
+			return err
+		}
+	}
+
+	incoming, err = fillPlaceholders(incoming, options.DryRun)
+	if err != nil {
+		return err
+	}
+
+	imported := incoming
+	var undecided []string
+	if options.Merge != "" && local != nil {
+		imported, undecided, err = mergeConfigurationFiles(local, incoming, options.Merge, options.DryRun)
 		if err != nil {
 			return err
 		}
 	}
 
-	configs, err := loadConfigsFrom(importPath)
+	err = validateImport(imported)
 	if err != nil {
 		return err
 	}
 
-	err = saveConfig(configs)
+	if options.DryRun {
+		fmt.Printf("Importing %s would change:\n", source)
+		err = printConfigDiff(local, imported)
+		if err != nil {
+			return err
+		}
+
+		if len(undecided) > 0 {
+			fmt.Println("You would be asked which value to keep for:")
+			for _, conflict := range undecided {
+				fmt.Printf("  ? %s\n", conflict)
+			}
+		}
+		return nil
+	}
+
+	if local != nil {
+		backupPath, err := backupConfigFile()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backed up the existing config file to %s\n", backupPath)
+	}
+
+	err = saveConfigurationFile(imported)
 	if err != nil {
 		return err
 	}
@@ -115,18 +197,80 @@ func ConfigImport(importPath string) error {
 	return nil
 }
 
-func ConfigExport(exportPath string) error {
-	stat, err := os.Stat(exportPath)
-	if err != nil {
-		return err
+// ConfigExport exports the config file, or its profiles in the format of
+// another tool
+func ConfigExport(exportPath string, options types.ExportOptions) error {
+	format := options.Format
+	if format == "" {
+		format = formatAwsure
 	}
 
-	if stat.IsDir() {
-		updatedExportPath := filepath.Join(exportPath, "configs.yaml")
+	stat, err := os.Stat(exportPath)
+	if err == nil && stat.IsDir() {
+		fileName := "configs.yaml"
+		if format != formatAwsure {
+			converter, err := configConverterFor(format)
+			if err != nil {
+				return err
+			}
+			fileName = converter.defaultFileName
+		}
+
+		updatedExportPath := filepath.Join(exportPath, fileName)
 		fmt.Printf("%s is a directory. configs will be stored as %s\n", exportPath, updatedExportPath)
 		exportPath = updatedExportPath
 	}
 
+	if format != formatAwsure {
+		if options.Share {
+			return fmt.Errorf("shared configs can only be exported for awsure")
+		}
+
+		err = exportConfigFile(exportPath, format, options.Profiles, options.Force)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Config has been exported for %s\n", format)
+		return nil
+	}
+
+	if options.Share || len(options.Profiles) > 0 {
+		configFile, err := loadConfigurationFile(defaultConfigLocation)
+		if err != nil {
+			return err
+		}
+
+		if len(options.Profiles) > 0 {
+			configFile, err = configFile.selectProfiles(options.Profiles, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		if options.Share {
+			err = exportSharedConfig(exportPath, configFile)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Config has been exported without personal values. Importing it asks for them")
+			return nil
+		}
+
+		content, err := yaml.Marshal(configFile)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(exportPath, content, 0644)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Config has been exported")
+		return nil
+	}
+
 	_, err = loadConfigs()
 	if err != nil {
 		return err
@@ -178,7 +322,88 @@ func loadConfigs() (map[string]*configuration, error) {
 	return loadConfigsFrom(defaultConfigLocation)
 }
 
+// loadConfigsFrom returns the profiles of the config file, resolved with the
+// identity and defaults blocks they inherit from. Profiles that can't be
+// resolved are reported and left out, so the others can still be used
 func loadConfigsFrom(path string) (map[string]*configuration, error) {
+	configFile, err := loadConfigurationFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, errs := configFile.resolvedConfigs()
+	for _, err := range errs {
+		warn("skipping %v", err)
+	}
+	return configs, nil
+}
+
+// resolvedConfigs returns the profiles that can be resolved, and an error for
+// each one that can't
+func (f *configurationFile) resolvedConfigs() (map[string]*configuration, []error) {
+	configs := make(map[string]*configuration, len(f.Configs))
+	var errs []error
+	for _, profile := range sortedProfiles(f.Configs) {
+		config := f.Configs[profile]
+		if config == nil {
+			config = &configuration{}
+		}
+
+		resolved, err := f.resolve(config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %v", profile, err))
+			continue
+		}
+		configs[profile] = resolved
+	}
+	return configs, errs
+}
+
+// resolve applies the defaults block, then the identity block and then the
+// values of the profile itself. The identity can also be named by the defaults
+func (f *configurationFile) resolve(config *configuration) (*configuration, error) {
+	layers, err := f.layers(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := &configuration{}
+	for _, layer := range layers {
+		resolved.Merge(layer.config)
+	}
+	return resolved, nil
+}
+
+// layers returns the blocks the profile inherits from, in the order they
+// apply, and then the profile
+func (f *configurationFile) layers(config *configuration) ([]configLayer, error) {
+	var layers []configLayer
+
+	identityName := config.Identity
+	if config.Defaults != "" {
+		defaults, ok := f.Defaults[config.Defaults]
+		if !ok || defaults == nil {
+			return nil, fmt.Errorf("the defaults %s don't exist", config.Defaults)
+		}
+		layers = append(layers, configLayer{source: "defaults " + config.Defaults, config: defaults})
+
+		if identityName == "" {
+			identityName = defaults.Identity
+		}
+	}
+
+	if identityName != "" {
+		identity, ok := f.Identities[identityName]
+		if !ok || identity == nil {
+			return nil, fmt.Errorf("the identity %s doesn't exist", identityName)
+		}
+		layers = append(layers, configLayer{source: "identity " + identityName, config: identity.configuration()})
+	}
+
+	return append(layers, configLayer{source: "profile", config: config}), nil
+}
+
+func loadConfigurationFile(path string) (*configurationFile, error) {
 	_, err := os.Stat(path)
 	if os.IsNotExist(err) {
 		return nil, fileNotFoundError
@@ -189,12 +414,76 @@ func loadConfigsFrom(path string) (map[string]*configuration, error) {
 		return nil, err
 	}
 
+	document := yaml.Node{}
+	err = yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
 	configFile := configurationFile{}
-	err = yaml.Unmarshal(content, &configFile)
-	return configFile.Configs, nil
+	if len(document.Content) == 0 {
+		return &configFile, nil
+	}
+	root := document.Content[0]
+
+	err = migrateConfigFile(path, root)
+	if err != nil {
+		return nil, err
+	}
+
+	reportConfigProblems(path, root)
+
+	err = root.Decode(&configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return &configFile, nil
 }
 
+// saveConfig saves the profiles, keeping the rest of the config file as it is.
+// Profiles that inherit from blocks only keep the values they override
 func saveConfig(configs map[string]*configuration) error {
+	configFile := &configurationFile{}
+	existing, err := loadConfigurationFile(defaultConfigLocation)
+	if err == nil {
+		configFile = existing
+	}
+
+	rawConfigs := make(map[string]*configuration, len(configs))
+	// Profiles that couldn't be resolved weren't loaded, and are kept as they
+	// are until they're fixed or removed
+	for profile, config := range configFile.Configs {
+		if _, ok := configs[profile]; ok {
+			continue
+		}
+		if _, err := configFile.resolve(config); err != nil {
+			rawConfigs[profile] = config
+		}
+	}
+	for profile, config := range configs {
+		rawConfigs[profile] = config
+
+		if config.Identity == "" && config.Defaults == "" {
+			continue
+		}
+
+		inherited, err := configFile.resolve(&configuration{Identity: config.Identity, Defaults: config.Defaults})
+		if err != nil {
+			return fmt.Errorf("profile %s: %v", profile, err)
+		}
+
+		raw := config.Unresolve(inherited)
+		if defaults := configFile.Defaults[raw.Defaults]; defaults != nil && defaults.Identity == raw.Identity {
+			raw.Identity = ""
+		}
+		rawConfigs[profile] = raw
+	}
+	configFile.Configs = rawConfigs
+
+	return saveConfigurationFile(configFile)
+}
+
+func saveConfigurationFile(configFile *configurationFile) error {
 	_, err := os.Stat(defaultConfigLocation)
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(filepath.Dir(defaultConfigLocation), 0755)
@@ -205,47 +494,18 @@ func saveConfig(configs map[string]*configuration) error {
 		return err
 	}
 
-	configFile := configurationFile{
-		Version: configFileVersion,
-		Configs: configs,
-	}
-	content, err := yaml.Marshal(configFile)
+	err = backupUnmigratedConfigFile(defaultConfigLocation)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(defaultConfigLocation, content, 0644)
-}
-
-func askConfig(config configuration, allowEmpty bool) (*configuration, error) {
-	prompter := Prompter{}
-
-	var err error
-	config.AzureTenantId, err = prompter.Prompt("Azure Tenant Id", config.AzureTenantId)
-	config.AzureAppIdUri, err = prompter.Prompt("Azure App Id Uri", config.AzureAppIdUri)
-	config.AzureUsername, err = prompter.Prompt("Azure Username", config.AzureUsername)
-	config.OktaUsername, err = prompter.Prompt("Okta Username", config.OktaUsername)
-	config.Region, err = prompter.Prompt("Region", "")
-	config.DefaultJumpRole, err = prompter.Prompt("Default Jump Role", config.DefaultJumpRole)
-	defaultDurationHours, err := prompter.Prompt("Default Duration (Hour)", strconv.Itoa(config.DefaultDurationHours))
-
-	config.DefaultDurationHours, err = strconv.Atoi(defaultDurationHours)
+	configFile.Version = configFileVersion
+	content, err := yaml.Marshal(configFile)
 	if err != nil {
-		if allowEmpty {
-			config.DefaultDurationHours = -1
-		} else {
-			fmt.Println("Not a valid duration was entered. Will set the duration to 1.")
-			config.DefaultDurationHours = 1
-		}
-	} else if config.DefaultDurationHours < 1 {
-		fmt.Println("Duration cannot be less than 1. Setting it to 1")
-		config.DefaultDurationHours = 1
-	} else if config.DefaultDurationHours > 12 {
-		fmt.Println("Duration cannot be greater than 12. Setting it to 12")
-		config.DefaultDurationHours = 12
+		return err
 	}
 
-	return &config, nil
+	return os.WriteFile(defaultConfigLocation, content, 0644)
 }
 
 func loadJumpRoleCredentials() (map[string]*jumpRoleCredentials, error) {
@@ -261,6 +521,14 @@ func loadJumpRoleCredentials() (map[string]*jumpRoleCredentials, error) {
 
 	file := jumpRoleCredentialsFile{}
 	err = yaml.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the jump role credentials from %s: %v. remove the file to log in again", defaultJumpRoleCredentialsFileLocation, err)
+	}
+
+	err = checkFileVersion(defaultJumpRoleCredentialsFileLocation, file.Version)
+	if err != nil {
+		return nil, err
+	}
 	return file.Credentials, nil
 }
 
@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const inheritanceConfig = `version: 1.1.0
+identities:
+  a:
+    idp: azure
+    azure_tenant_id: tenant-a
+    azure_app_id_uri: app-a
+    remember_me: true
+  b:
+    idp: azure
+    azure_tenant_id: tenant-b
+defaults:
+  team:
+    identity: a
+    region: eu-west-1
+    default_duration_hours: 4
+configs:
+  plain:
+    azure_tenant_id: tenant-p
+  inherits:
+    defaults: team
+  overrides:
+    defaults: team
+    identity: b
+    region: us-east-1
+  explicit:
+    identity: a
+    remember_me: false
+  missing-defaults:
+    defaults: nope
+  missing-identity:
+    identity: nope
+`
+
+func readConfigFile(t *testing.T, content string) *configurationFile {
+	t.Helper()
+
+	configFile := &configurationFile{}
+	err := yaml.Unmarshal([]byte(content), configFile)
+	if err != nil {
+		t.Fatalf("failed to read the config: %v", err)
+	}
+	return configFile
+}
+
+func TestResolve(t *testing.T) {
+	configFile := readConfigFile(t, inheritanceConfig)
+
+	tests := []struct {
+		profile string
+		want    configuration
+		sources []string
+		wantErr string
+	}{
+		{
+			profile: "plain",
+			want:    configuration{AzureTenantId: "tenant-p"},
+			sources: []string{"profile"},
+		},
+		{
+			profile: "inherits",
+			want: configuration{Defaults: "team", Identity: "a", Idp: "azure", AzureTenantId: "tenant-a",
+				AzureAppIdUri: "app-a", RememberMe: true, Region: "eu-west-1", DefaultDurationHours: 4},
+			sources: []string{"defaults team", "identity a", "profile"},
+		},
+		{
+			profile: "overrides",
+			want: configuration{Defaults: "team", Identity: "b", Idp: "azure", AzureTenantId: "tenant-b",
+				Region: "us-east-1", DefaultDurationHours: 4},
+			sources: []string{"defaults team", "identity b", "profile"},
+		},
+		{
+			profile: "explicit",
+			want: configuration{Identity: "a", Idp: "azure", AzureTenantId: "tenant-a",
+				AzureAppIdUri: "app-a"},
+			sources: []string{"identity a", "profile"},
+		},
+		{
+			profile: "missing-defaults",
+			wantErr: "the defaults nope don't exist",
+		},
+		{
+			profile: "missing-identity",
+			wantErr: "the identity nope doesn't exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			config := configFile.Configs[tt.profile]
+
+			layers, err := configFile.layers(config)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("layers() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("layers() error = %v", err)
+			}
+
+			var sources []string
+			for _, layer := range layers {
+				sources = append(sources, layer.source)
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("layers() = %v, want %v", sources, tt.sources)
+			}
+
+			resolved, err := configFile.resolve(config)
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+			resolved.explicit = nil
+			if !reflect.DeepEqual(*resolved, tt.want) {
+				t.Errorf("resolve() = %+v, want %+v", *resolved, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvedConfigs(t *testing.T) {
+	configFile := readConfigFile(t, inheritanceConfig)
+
+	configs, errs := configFile.resolvedConfigs()
+	if len(configs) != 4 {
+		t.Errorf("resolvedConfigs() resolved %d profiles, want 4", len(configs))
+	}
+	if len(errs) != 2 {
+		t.Fatalf("resolvedConfigs() errors = %v, want 2", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "profile missing-defaults:") {
+		t.Errorf("resolvedConfigs() error = %v, want it to name the profile", errs[0])
+	}
+}
+
+func TestUnresolve(t *testing.T) {
+	inherited := &configuration{Idp: "azure", AzureTenantId: "tenant-a", RememberMe: true, Region: "eu-west-1",
+		BrowserArgs: []string{"--incognito"}}
+
+	tests := []struct {
+		name     string
+		config   *configuration
+		explicit []string
+		want     *configuration
+		wantKeys []string
+	}{
+		{
+			name:   "inherited values are dropped",
+			config: &configuration{Identity: "a", Idp: "azure", AzureTenantId: "tenant-a", RememberMe: true, Region: "eu-west-1"},
+			want:   &configuration{Identity: "a"},
+		},
+		{
+			name:   "overridden values are kept",
+			config: &configuration{Identity: "a", Idp: "azure", AzureTenantId: "tenant-a", Region: "us-east-1", BrowserArgs: []string{"--headless"}},
+			want:   &configuration{Identity: "a", Region: "us-east-1", BrowserArgs: []string{"--headless"}},
+		},
+		{
+			name:     "empty values set on purpose are kept",
+			config:   &configuration{Identity: "a", Idp: "azure", AzureTenantId: "tenant-a"},
+			explicit: []string{"remember_me", "region"},
+			want:     &configuration{Identity: "a"},
+			wantKeys: []string{"region", "remember_me"},
+		},
+		{
+			name:   "empty values that aren't explicit are inherited again",
+			config: &configuration{Identity: "a"},
+			want:   &configuration{Identity: "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range tt.explicit {
+				tt.config.markExplicit(key)
+			}
+
+			got := tt.config.Unresolve(inherited)
+
+			var keys []string
+			for key := range got.explicit {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("Unresolve() explicit keys = %v, want %v", keys, tt.wantKeys)
+			}
+
+			got.explicit = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unresolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplicitKeysRoundTrip(t *testing.T) {
+	configFile := readConfigFile(t, inheritanceConfig)
+
+	content, err := yaml.Marshal(configFile.Configs["explicit"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "identity: a\nremember_me: false\n"; string(content) != want {
+		t.Errorf("yaml.Marshal() = %q, want %q", content, want)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	configFile := readConfigFile(t, inheritanceConfig)
+
+	tests := []struct {
+		name     string
+		profile  string
+		change   func(config *configuration)
+		want     configuration
+		wantKeys []string
+	}{
+		{
+			name:    "nothing changed",
+			profile: "inherits",
+			change:  func(config *configuration) {},
+			want:    configuration{Defaults: "team"},
+		},
+		{
+			name:    "changed values are set",
+			profile: "inherits",
+			change: func(config *configuration) {
+				config.Region = "us-east-1"
+				config.DestinationAccountId = "123456789012"
+			},
+			want: configuration{Defaults: "team", Region: "us-east-1", DestinationAccountId: "123456789012"},
+		},
+		{
+			name:    "another identity doesn't keep the values of the previous one",
+			profile: "inherits",
+			change:  func(config *configuration) { config.Identity = "b" },
+			want:    configuration{Defaults: "team", Identity: "b"},
+		},
+		{
+			name:     "cleared values are set on purpose",
+			profile:  "inherits",
+			change:   func(config *configuration) { config.RememberMe = false },
+			want:     configuration{Defaults: "team"},
+			wantKeys: []string{"remember_me"},
+		},
+		{
+			name:    "values of the profile are kept",
+			profile: "overrides",
+			change:  func(config *configuration) { config.AzureUsername = "user@example.com" },
+			want:    configuration{Defaults: "team", Identity: "b", Region: "us-east-1", AzureUsername: "user@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *configFile.Configs[tt.profile]
+			config.explicit = nil
+
+			before, err := configFile.resolve(&config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := *before
+			tt.change(&after)
+
+			config.applyChanges(before, &after)
+
+			var keys []string
+			for key := range config.explicit {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("applyChanges() explicit keys = %v, want %v", keys, tt.wantKeys)
+			}
+
+			config.explicit = nil
+			if !reflect.DeepEqual(config, tt.want) {
+				t.Errorf("applyChanges() = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+// TestConfigProfileSave saves the answers of the wizard like ConfigProfile
+// does, without asking for them
+func TestConfigProfileSave(t *testing.T) {
+	path := useConfigLocation(t, inheritanceConfig)
+
+	configFile, err := loadConfigurationFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := configFile.Configs["inherits"]
+	current, err := configFile.resolve(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := *current
+	answers.Identity = "b"
+	answers.Region = "us-west-2"
+	config.applyChanges(current, &answers)
+	if err := saveConfigurationFile(configFile); err != nil {
+		t.Fatalf("saveConfigurationFile() error = %v", err)
+	}
+
+	configs, err := loadConfigsFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := configs["inherits"]
+	if got.AzureTenantId != "tenant-b" || got.AzureAppIdUri != "" || got.RememberMe || got.Region != "us-west-2" {
+		t.Errorf("resolved profile = %+v, want the values of identity b and the new region", got)
+	}
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// formatAwsure is the format of awsure's own config file
+const formatAwsure = "awsure"
+
+// configConverter reads and writes the config files of other tools, so teams
+// can bring their setups over
+type configConverter struct {
+	// defaultFileName is the name of the file when exporting to a directory
+	defaultFileName string
+	read            func(file *ini.File) (map[string]*configuration, error)
+	write           func(configs map[string]*configuration) (*ini.File, error)
+}
+
+var configConverters = map[string]*configConverter{}
+
+func registerConfigConverter(format string, converter *configConverter) {
+	configConverters[format] = converter
+}
+
+// ConfigFormats are the formats configs can be imported from and exported to
+func ConfigFormats() []string {
+	var formats []string
+	for format := range configConverters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return append([]string{formatAwsure}, formats...)
+}
+
+func configConverterFor(format string) (*configConverter, error) {
+	converter, ok := configConverters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s. the formats are %v", format, ConfigFormats())
+	}
+	return converter, nil
+}
+
+// convertConfigFile reads the file of another tool as an awsure config file
+func convertConfigFile(path string, format string) (*configurationFile, error) {
+	converter, err := configConverterFor(format)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	configs, err := converter.read(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s has no %s profiles", path, format)
+	}
+
+	configFile := &configurationFile{
+		Version: configFileVersion,
+		Configs: configs,
+	}
+
+	node := &yaml.Node{}
+	err = node.Encode(configFile)
+	if err != nil {
+		return nil, err
+	}
+	reportConfigProblems(path, node)
+
+	return configFile, nil
+}
+
+// exportConfigFile writes the profiles, with the values they inherit, in the
+// format of another tool. An existing file, which can have the settings of
+// other tools like ~/.aws/config does, is only changed with force. It's backed
+// up and only the keys awsure writes are updated
+func exportConfigFile(path string, format string, profiles []string, force bool) error {
+	converter, err := configConverterFor(format)
+	if err != nil {
+		return err
+	}
+
+	configs, err := loadConfigs()
+	if err != nil {
+		return err
+	}
+
+	if len(profiles) > 0 {
+		selected := make(map[string]*configuration, len(profiles))
+		for _, profile := range profiles {
+			config, ok := configs[profile]
+			if !ok {
+				return fmt.Errorf("profile %s does not exist", profile)
+			}
+			selected[profile] = config
+		}
+		configs = selected
+	}
+
+	exported, err := converter.write(configs)
+	if err != nil {
+		return err
+	}
+	if len(exported.Sections()) <= 1 {
+		return fmt.Errorf("there are no profiles %s supports", format)
+	}
+
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return exported.SaveTo(path)
+	} else if err != nil {
+		return err
+	}
+
+	if !force {
+		return fmt.Errorf("%s already exists. use --force to update its profiles, after it's backed up", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := ini.Load(content)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	for _, section := range exported.Sections() {
+		if len(section.Keys()) == 0 {
+			continue
+		}
+
+		existing := file.Section(section.Name())
+		for _, key := range section.Keys() {
+			// Values awsure doesn't know, like the app_id of saml2aws, are
+			// kept
+			if key.Value() == "" && existing.HasKey(key.Name()) {
+				continue
+			}
+			existing.Key(key.Name()).SetValue(key.Value())
+		}
+	}
+
+	backupPath, err := backupFile(path, content, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s to %s\n", path, backupPath)
+
+	return file.SaveTo(path)
+}
+
+// applyRoleArn logs the profile in to the role directly, as the other tools
+// don't assume a destination role from a jump role
+func applyRoleArn(config *configuration, roleArn string) {
+	accountId := accountIdFromArn(roleArn)
+	if accountId == "" {
+		return
+	}
+
+	config.DefaultJumpRole = roleArn
+	config.DestinationAccountId = accountId
+	config.DestinationRoleName = roleNameFromArn(roleArn)
+}
+
+// exportedRoleArn is the role another tool logs in to for the profile. It
+// warns when the profile assumes a destination role the tool can't
+func exportedRoleArn(profile string, config *configuration, format string) string {
+	if config.DestinationAccountId == "" || config.DestinationRoleName == "" {
+		return config.DefaultJumpRole
+	}
+
+	destinationRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", config.DestinationAccountId, config.DestinationRoleName)
+	if config.DefaultJumpRole != "" && destinationRoleArn != config.DefaultJumpRole {
+		warn("%s assumes %s from the jump role, which %s can't do. it will log in to the jump role", profile, destinationRoleArn, format)
+		return config.DefaultJumpRole
+	}
+	return destinationRoleArn
+}
+
+// sessionHours turns a duration in seconds into the hours awsure allows
+func sessionHours(seconds string) int {
+	value, err := strconv.Atoi(seconds)
+	if err != nil || value <= 0 {
+		return 0
+	}
+	return clampHours(value / 3600)
+}
+
+func clampHours(hours int) int {
+	if hours < 1 {
+		return 1
+	}
+	if hours > 12 {
+		return 12
+	}
+	return hours
+}
+
+func warnMissingValue(profile string, key string) {
+	warn("%s has no %s. set it with 'awsure config set -p %s %s=...'", profile, key, profile, key)
+}
+
+func sortedProfiles(configs map[string]*configuration) []string {
+	var profiles []string
+	for profile := range configs {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
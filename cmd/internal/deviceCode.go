@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const azureLoginEndpoint = "https://login.microsoftonline.com"
+
+const azureClientSecretEnv = "AWSURE_AZURE_CLIENT_SECRET"
+
+// loginDeviceCode logs in to Azure with the device code flow and exchanges the
+// token for a SAML assertion of the AWS app with the on-behalf-of flow. This
+// needs an app registration, configured as azure_client_id, that allows public
+// client flows and has a client secret and access to the AWS app. The secret
+// is only read from AWSURE_AZURE_CLIENT_SECRET, as it's for administrators.
+func loginDeviceCode(ctx context.Context, config *configuration, options types.Configuration) (string, error) {
+	if config.AzureClientId == "" {
+		return "", fmt.Errorf("azure_client_id is required to log in with the device code flow")
+	}
+
+	// The on-behalf-of flow needs a confidential client, so whoever logs in
+	// this way has the secret of the app. It's meant for machines an
+	// administrator sets up, and is never asked for
+	clientSecret := os.Getenv(azureClientSecretEnv)
+	if clientSecret == "" {
+		return "", fmt.Errorf("the device code flow needs the client secret of the app registration in %s. "+
+			"anyone with the secret can get tokens for the app, so only administrators should set it up, on machines they manage. "+
+			"use auth_mode system_browser otherwise", azureClientSecretEnv)
+	}
+
+	client, err := newHttpClient(resolveBrowserSettings(config))
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withLoginTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	deviceCodeUrl := fmt.Sprintf("%s/%s/oauth2/v2.0/devicecode", azureLoginEndpoint, config.AzureTenantId)
+	deviceCode := azureDeviceCodeResponse{}
+	err = azurePostForm(ctx, client, deviceCodeUrl, url.Values{
+		"client_id": {config.AzureClientId},
+		"scope":     {fmt.Sprintf("%s/.default", config.AzureClientId)},
+	}, &deviceCode)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println(deviceCode.Message)
+
+	accessToken, err := pollDeviceCodeToken(ctx, client, config, deviceCode)
+	if err != nil {
+		return "", err
+	}
+
+	tokenUrl := fmt.Sprintf("%s/%s/oauth2/token", azureLoginEndpoint, config.AzureTenantId)
+	token := azureTokenResponse{}
+	err = azurePostForm(ctx, client, tokenUrl, url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":            {accessToken},
+		"client_id":            {config.AzureClientId},
+		"client_secret":        {clientSecret},
+		"resource":             {config.AzureAppIdUri},
+		"requested_token_use":  {"on_behalf_of"},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:saml2"},
+	}, &token)
+	if err != nil {
+		return "", err
+	}
+
+	assertion, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(token.AccessToken, "="))
+	if err != nil {
+		return "", fmt.Errorf("azure returned an invalid SAML assertion: %v", err)
+	}
+
+	return wrapSamlAssertion(string(assertion)), nil
+}
+
+func pollDeviceCodeToken(ctx context.Context, client *http.Client, config *configuration, deviceCode azureDeviceCodeResponse) (string, error) {
+	tokenUrl := fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureLoginEndpoint, config.AzureTenantId)
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token := azureTokenResponse{}
+		err := azurePostForm(ctx, client, tokenUrl, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"client_id":   {config.AzureClientId},
+			"device_code": {deviceCode.DeviceCode},
+		}, &token)
+		if err == nil {
+			return token.AccessToken, nil
+		}
+
+		switch token.Error {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "expired_token":
+			return "", fmt.Errorf("the device code expired before the login was completed")
+		default:
+			return "", err
+		}
+	}
+}
+
+// azurePostForm posts the form and decodes the response into result. Errors
+// returned by Azure are still decoded so callers can check the error code.
+func azurePostForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		// Proxies and gateways answer with pages that aren't JSON, so only
+		// the status is known
+		azureError := azureTokenResponse{}
+		if json.Unmarshal(content, &azureError) != nil || azureError.Error == "" {
+			return fmt.Errorf("azure returned %s", res.Status)
+		}
+		_ = json.Unmarshal(content, result)
+
+		if err = loginErrorFromText(azureError.ErrorDescription); err != nil {
+			return err
+		}
+		return fmt.Errorf("azure returned %s: %s", azureError.Error, azureError.ErrorDescription)
+	}
+
+	err = json.Unmarshal(content, result)
+	if err != nil {
+		return fmt.Errorf("failed to read the azure response: %v", err)
+	}
+
+	return nil
+}
+
+// wrapSamlAssertion puts a SAML assertion in a SAML response, as that's what
+// AWS expects, and encodes it the way the browser would post it
+func wrapSamlAssertion(assertion string) string {
+	assertion = strings.TrimSpace(assertion)
+	if strings.HasPrefix(assertion, "<?xml") {
+		if i := strings.Index(assertion, "?>"); i >= 0 {
+			assertion = assertion[i+2:]
+		}
+	}
+
+	response := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_%s" Version="2.0" IssueInstant="%s" Destination="%s"><samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>%s</samlp:Response>`,
+		uuid.NewString(), time.Now().UTC().Format(time.RFC3339), AwsSamlEndpoint, assertion)
+
+	return base64.StdEncoding.EncodeToString([]byte(response))
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAzurePostForm(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantErr   error
+		wantMsg   string
+		wantToken azureTokenResponse
+	}{
+		{
+			name:      "token",
+			status:    http.StatusOK,
+			body:      `{"access_token":"token"}`,
+			wantToken: azureTokenResponse{AccessToken: "token"},
+		},
+		{
+			name:      "pending login keeps the error code",
+			status:    http.StatusBadRequest,
+			body:      `{"error":"authorization_pending","error_description":"AADSTS70016: pending"}`,
+			wantMsg:   "azure returned authorization_pending: AADSTS70016: pending",
+			wantToken: azureTokenResponse{Error: "authorization_pending", ErrorDescription: "AADSTS70016: pending"},
+		},
+		{
+			name:      "known login error",
+			status:    http.StatusBadRequest,
+			body:      `{"error":"invalid_grant","error_description":"AADSTS50126: Error validating credentials"}`,
+			wantErr:   invalidCredentialsError,
+			wantToken: azureTokenResponse{Error: "invalid_grant", ErrorDescription: "AADSTS50126: Error validating credentials"},
+		},
+		{
+			name:    "html error page keeps the status",
+			status:  http.StatusBadGateway,
+			body:    `<html><body>Bad Gateway</body></html>`,
+			wantMsg: "azure returned 502 Bad Gateway",
+		},
+		{
+			name:    "invalid json",
+			status:  http.StatusOK,
+			body:    `<html></html>`,
+			wantMsg: "failed to read the azure response: invalid character '<' looking for beginning of value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			token := azureTokenResponse{}
+			err := azurePostForm(context.Background(), server.Client(), server.URL, url.Values{}, &token)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantMsg != "":
+				if err == nil || err.Error() != tt.wantMsg {
+					t.Errorf("error = %v, want %q", err, tt.wantMsg)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if token != tt.wantToken {
+				t.Errorf("token = %+v, want %+v", token, tt.wantToken)
+			}
+		})
+	}
+}
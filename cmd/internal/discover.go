@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const DefaultDiscoverNameTemplate = "{{.Alias}}-{{.Role}}"
+
+var profileNameInvalidCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// discoveredRole is a role `awsure config discover` can create a profile for
+type discoveredRole struct {
+	accountId string
+	roleName  string
+	// jumpRoleArn is the role in the SAML response the profile logs in with.
+	// It's the role itself for the roles of the SAML response
+	jumpRoleArn string
+}
+
+// profileNameData is what the name template of `awsure config discover` can use
+type profileNameData struct {
+	Account string
+	Alias   string
+	Role    string
+	Base    string
+}
+
+// ConfigDiscover logs in with the identity of the profile and creates a profile
+// for each selected role of the SAML response. With the organization option,
+// it also offers a role with the given name in every account of the
+// organization, assumed through the jump role.
+func ConfigDiscover(ctx context.Context, profile string, options types.Configuration, discoverOptions types.DiscoverOptions) error {
+	nameTemplate, err := template.New("name").Option("missingkey=error").Parse(discoverOptions.NameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid name template %s: %v", discoverOptions.NameTemplate, err)
+	}
+
+	if discoverOptions.Organization && discoverOptions.RoleName == "" {
+		return fmt.Errorf("the role name to use in the accounts of the organization is required")
+	}
+
+	configs, err := loadConfigs()
+	if errors.Is(err, fileNotFoundError) {
+		fmt.Println("We couldn't find any config files. Let's configure how to log in first")
+		err = ConfigProfile(profile)
+		if err != nil {
+			return err
+		}
+		configs, err = loadConfigs()
+	}
+	if err != nil {
+		return err
+	}
+
+	base, ok := configs[profile]
+	if !ok {
+		return fmt.Errorf("profile %s does not exist. the new profiles log in like it, so please configure it first", profile)
+	}
+
+	saml, err := getSaml(ctx, base, options)
+	if err != nil {
+		return err
+	}
+
+	samlResponse, err := decodeSamlResponse(saml)
+	if err != nil {
+		return err
+	}
+	roles, err := samlResponse.roles()
+	if err != nil {
+		return err
+	}
+
+	var discovered []discoveredRole
+	for _, r := range roles {
+		discovered = append(discovered, discoveredRole{
+			accountId:   accountIdFromArn(r.roleArn),
+			roleName:    roleNameFromArn(r.roleArn),
+			jumpRoleArn: r.roleArn,
+		})
+	}
+
+	aliases := accountAliases()
+
+	if discoverOptions.Organization {
+		organizationRoles, err := discoverOrganizationRoles(ctx, base, saml, discoverOptions.RoleName, aliases)
+		if err != nil {
+			return err
+		}
+		discovered = append(discovered, organizationRoles...)
+	}
+
+	discovered = uniqueDiscoveredRoles(discovered)
+	if len(discovered) == 0 {
+		return fmt.Errorf("you don't have access to any role. please contact your administrator to add you to appropriate groups")
+	}
+
+	var items []string
+	var selected []bool
+	for _, d := range discovered {
+		destinationRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", d.accountId, d.roleName)
+		item := roleDisplayName(destinationRoleArn, aliases)
+		if d.jumpRoleArn != destinationRoleArn {
+			item = fmt.Sprintf("%s via %s", item, roleDisplayName(d.jumpRoleArn, aliases))
+		}
+		items = append(items, item)
+
+		_, exists := configs[discoveredProfileName(nameTemplate, d, aliases, profile)]
+		selected = append(selected, !exists)
+	}
+
+	prompter := Prompter{}
+	indexes, err := prompter.MultiSelect("Select the roles to create profiles for", items, selected)
+	if err != nil {
+		return err
+	}
+
+	created := 0
+	for _, i := range indexes {
+		d := discovered[i]
+		name := discoveredProfileName(nameTemplate, d, aliases, profile)
+		if name == "" {
+			return fmt.Errorf("the name template %s gives an empty name for %s", discoverOptions.NameTemplate, items[i])
+		}
+
+		if _, exists := configs[name]; exists && !discoverOptions.Overwrite {
+			fmt.Printf("Profile %s already exists. Skipping it\n", name)
+			continue
+		}
+
+		config := *base
+		config.DestinationAccountId = d.accountId
+		config.DestinationRoleName = d.roleName
+		config.DefaultJumpRole = d.jumpRoleArn
+		configs[name] = &config
+
+		fmt.Printf("Created %s profile for %s\n", name, items[i])
+		created++
+	}
+
+	if created == 0 {
+		fmt.Println("No profile was created")
+		return nil
+	}
+
+	return saveConfig(configs)
+}
+
+// discoverOrganizationRoles logs in to a jump role and lists the accounts of
+// the organization, offering roleName in each of them
+func discoverOrganizationRoles(ctx context.Context, base *configuration, saml string, roleName string, aliases map[string]string) ([]discoveredRole, error) {
+	jumpRole, loggedInJumpRole, err := loginToJumpRole(ctx, base, saml)
+	if err != nil {
+		return nil, err
+	}
+
+	jumpRoles, err := loadJumpRoleCredentials()
+	if err != nil || jumpRoles == nil {
+		jumpRoles = make(map[string]*jumpRoleCredentials)
+	}
+	jumpRoles[jumpRole.roleArn] = loggedInJumpRole
+	err = saveJumpRoleCredentials(jumpRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig, err := staticCredentialsConfig(ctx, loggedInJumpRole.AwsAccessKeyId, loggedInJumpRole.AwsSecretAccessKey, loggedInJumpRole.AwsSessionToken, base.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := organizationAccounts(ctx, awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list the accounts of the organization with %s: %v", jumpRole.roleArn, err)
+	}
+
+	var accountIds []string
+	for id, name := range accounts {
+		accountIds = append(accountIds, id)
+		if _, ok := aliases[id]; !ok {
+			aliases[id] = name
+		}
+	}
+	sort.Strings(accountIds)
+
+	var discovered []discoveredRole
+	for _, id := range accountIds {
+		discovered = append(discovered, discoveredRole{
+			accountId:   id,
+			roleName:    roleName,
+			jumpRoleArn: jumpRole.roleArn,
+		})
+	}
+
+	return discovered, nil
+}
+
+// uniqueDiscoveredRoles drops the roles found more than once. The roles of the
+// SAML response come first, so they're kept over the ones reached through a
+// jump role
+func uniqueDiscoveredRoles(discovered []discoveredRole) []discoveredRole {
+	seen := make(map[string]bool)
+	var unique []discoveredRole
+
+	for _, d := range discovered {
+		key := d.accountId + "/" + d.roleName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, d)
+	}
+
+	return unique
+}
+
+func discoveredProfileName(nameTemplate *template.Template, d discoveredRole, aliases map[string]string, base string) string {
+	alias := aliases[d.accountId]
+	if alias == "" {
+		alias = d.accountId
+	}
+
+	data := profileNameData{
+		Account: d.accountId,
+		Alias:   alias,
+		Role:    d.roleName[strings.LastIndex(d.roleName, "/")+1:],
+		Base:    base,
+	}
+
+	var name bytes.Buffer
+	err := nameTemplate.Execute(&name, data)
+	if err != nil {
+		return ""
+	}
+
+	return strings.Trim(profileNameInvalidCharacters.ReplaceAllString(name.String(), "-"), "-")
+}
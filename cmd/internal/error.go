@@ -1,5 +1,123 @@
 package internal
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/cdp"
+	"github.com/manifoldco/promptui"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
 
 var fileNotFoundError = errors.New("file not found")
+
+var loginTimeoutError = errors.New("login did not complete in time")
+var accountLockedError = errors.New("the account is locked")
+var invalidCredentialsError = errors.New("the username or password is incorrect")
+var invalidPasscodeError = errors.New("the passcode is invalid")
+var passwordExpiredError = errors.New("your password has expired. please change it and try again")
+var conditionalAccessError = errors.New("the sign in was blocked by a conditional access policy")
+
+var encryptedAssertionError = errors.New("the SAML assertion is encrypted, so awsure can't read the roles from it. please ask your administrator to turn off token encryption for the AWS app")
+var invalidSamlRoleError = errors.New("invalid role in the SAML response")
+var samlVerificationError = errors.New("the SAML response failed verification")
+
+var configCanceledError = errors.New("the configuration was canceled. nothing was saved")
+
+// loginErrorCodes map the error codes identity providers show, like Azure's
+// AADSTS codes and Okta's E codes, to the known login errors
+var loginErrorCodes = map[string]error{
+	"AADSTS50053": accountLockedError,
+	"AADSTS53003": conditionalAccessError,
+	"AADSTS50126": invalidCredentialsError,
+	"AADSTS50034": invalidCredentialsError,
+	"E0000004":    invalidCredentialsError,
+	"E0000069":    accountLockedError,
+}
+
+var loginErrorCodePattern = regexp.MustCompile(`\b(AADSTS\d+|E\d{7})\b`)
+
+// loginErrorMessages are the messages identity providers show in their error
+// elements without a code
+var loginErrorMessages = []struct {
+	message string
+	err     error
+}{
+	{"your account is locked", accountLockedError},
+	{"your account has been locked", accountLockedError},
+	{"your account or password is incorrect", invalidCredentialsError},
+	{"this username may be incorrect", invalidCredentialsError},
+	{"we couldn't find an account with that username", invalidCredentialsError},
+	{"that microsoft account doesn't exist", invalidCredentialsError},
+	{"unable to sign in", invalidCredentialsError},
+	{"you cannot access this right now", conditionalAccessError},
+	{"you can't get there from here", conditionalAccessError},
+}
+
+// loginErrorFromText maps the text of an identity provider's error element to
+// one of the known login errors, by its error code or else its whole message.
+// It returns nil when the text is not recognized.
+func loginErrorFromText(text string) error {
+	text = strings.TrimSpace(text)
+
+	for _, code := range loginErrorCodePattern.FindAllString(text, -1) {
+		if err, ok := loginErrorCodes[code]; ok {
+			return fmt.Errorf("%w: %s", err, text)
+		}
+	}
+
+	lower := strings.ToLower(strings.ReplaceAll(text, "’", "'"))
+	for _, known := range loginErrorMessages {
+		if strings.Contains(lower, known.message) {
+			return fmt.Errorf("%w: %s", known.err, text)
+		}
+	}
+
+	return nil
+}
+
+// friendlyLoginError replaces the errors of the browser and the network with
+// messages that tell the user what went wrong
+func friendlyLoginError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var navigationError *rod.NavigationError
+	var elementNotFoundError *rod.ElementNotFoundError
+	var cdpError *cdp.Error
+	var netError net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return loginTimeoutError
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.As(err, &navigationError):
+		return fmt.Errorf("couldn't open the login page (%s). please check your network connection and proxy settings", navigationError.Reason)
+	case errors.As(err, &elementNotFoundError):
+		return fmt.Errorf("the login page changed before awsure could use it. please try again")
+	case errors.As(err, &cdpError):
+		return fmt.Errorf("the browser failed during the login: %s", cdpError.Message)
+	case errors.As(err, &netError):
+		return fmt.Errorf("couldn't reach the identity provider: %v. please check your network connection and proxy settings", err)
+	}
+
+	return err
+}
+
+// IsInterrupted reports whether err is the result of the user interrupting
+// awsure, either with a signal or with Ctrl-C in a prompt
+func IsInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, promptui.ErrInterrupt)
+}
+
+// warn prints a warning to stderr, so it doesn't mix with the output of
+// commands that is read by scripts
+func warn(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
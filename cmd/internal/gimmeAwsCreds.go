@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"net/url"
+	"strconv"
+)
+
+const formatGimmeAwsCreds = "gimme-aws-creds"
+
+func init() {
+	registerConfigConverter(formatGimmeAwsCreds, &configConverter{
+		defaultFileName: ".okta_aws_login_config",
+		read:            readGimmeAwsCreds,
+		write:           writeGimmeAwsCreds,
+	})
+}
+
+// readGimmeAwsCreds reads the profiles of ~/.okta_aws_login_config. Like in
+// gimme-aws-creds, profiles take the values they don't have from DEFAULT,
+// which is imported as the default profile
+func readGimmeAwsCreds(file *ini.File) (map[string]*configuration, error) {
+	configs := make(map[string]*configuration)
+	defaults := file.Section(ini.DefaultSection)
+
+	value := func(section *ini.Section, key string) string {
+		if section.HasKey(key) {
+			return section.Key(key).String()
+		}
+		return defaults.Key(key).String()
+	}
+
+	for _, section := range file.Sections() {
+		if value(section, "okta_org_url") == "" && value(section, "app_url") == "" {
+			continue
+		}
+
+		profile := section.Name()
+		if profile == ini.DefaultSection {
+			profile = "default"
+		}
+
+		config := &configuration{
+			Idp:                  idpOkta,
+			OktaAppUrl:           value(section, "app_url"),
+			OktaUsername:         value(section, "okta_username"),
+			DefaultDurationHours: sessionHours(value(section, "aws_default_duration")),
+		}
+		applyRoleArn(config, value(section, "aws_rolename"))
+
+		if config.OktaAppUrl == "" {
+			// gimme-aws-creds can find the app through the Okta api, which
+			// awsure doesn't use
+			warnMissingValue(profile, "okta_app_url")
+		}
+		configs[profile] = config
+	}
+
+	return configs, nil
+}
+
+func writeGimmeAwsCreds(configs map[string]*configuration) (*ini.File, error) {
+	file := ini.Empty()
+
+	for _, profile := range sortedProfiles(configs) {
+		config := configs[profile]
+		if config.Idp != idpOkta {
+			warn("%s logs in to Azure, which %s doesn't support. skipping it", profile, formatGimmeAwsCreds)
+			continue
+		}
+
+		section, err := file.NewSection(profile)
+		if err != nil {
+			return nil, err
+		}
+
+		orgUrl := ""
+		if appUrl, err := url.Parse(config.OktaAppUrl); err == nil && appUrl.Host != "" {
+			orgUrl = fmt.Sprintf("%s://%s", appUrl.Scheme, appUrl.Host)
+		}
+
+		values := [][2]string{
+			{"okta_org_url", orgUrl},
+			{"app_url", config.OktaAppUrl},
+			{"okta_username", config.OktaUsername},
+			{"aws_rolename", exportedRoleArn(profile, config, formatGimmeAwsCreds)},
+			{"aws_default_duration", strconv.Itoa(clampHours(config.DefaultDurationHours) * 3600)},
+			{"write_aws_creds", "True"},
+			{"cred_profile", profile},
+		}
+		for _, value := range values {
+			if value[1] != "" {
+				_, _ = section.NewKey(value[0], value[1])
+			}
+		}
+	}
+
+	return file, nil
+}
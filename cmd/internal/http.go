@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+func newHttpClient(settings browserSettings) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if settings.proxy != "" {
+		proxyUrl, err := url.Parse(settings.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %v", settings.proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if settings.caBundle != "" {
+		pool, err := caBundlePool(settings.caBundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{
+		Jar:       jar,
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}, nil
+}
+
+// caBundlePool returns the system's certificate authorities with the ones of
+// the ca bundle
+func caBundlePool(path string) (*x509.CertPool, error) {
+	certificates, err := loadCaBundle(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, certificate := range certificates {
+		pool.AddCert(certificate)
+	}
+	return pool, nil
+}
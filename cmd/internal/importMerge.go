@@ -0,0 +1,359 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	mergeKeepLocal    = "keep-local"
+	mergeTakeIncoming = "take-incoming"
+	mergePrompt       = "prompt"
+)
+
+var MergeStrategies = []string{mergeKeepLocal, mergeTakeIncoming, mergePrompt}
+
+// maxConfigBackups is how many backups of the config file imports keep
+const maxConfigBackups = 5
+
+// configBackupTimeFormat names backups down to the millisecond, so imports run
+// in the same second don't overwrite each other's backup
+const configBackupTimeFormat = "20060102-150405.000"
+
+// configMerger merges an incoming config file into the local one. Values only
+// one of them has are kept, and values that differ are resolved by strategy
+type configMerger struct {
+	strategy string
+	dryRun   bool
+	prompter Prompter
+	// undecided are the conflicts a dry run would prompt for
+	undecided []string
+}
+
+func mergeConfigurationFiles(local *configurationFile, incoming *configurationFile, strategy string, dryRun bool) (*configurationFile, []string, error) {
+	localNode := &yaml.Node{}
+	err := localNode.Encode(local)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	incomingNode := &yaml.Node{}
+	err = incomingNode.Encode(incoming)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merger := &configMerger{strategy: strategy, dryRun: dryRun}
+	err = merger.merge(localNode, incomingNode, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := &configurationFile{}
+	err = localNode.Decode(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, merger.undecided, nil
+}
+
+func (m *configMerger) merge(local *yaml.Node, incoming *yaml.Node, path string) error {
+	for i := 0; i+1 < len(incoming.Content); i += 2 {
+		key := incoming.Content[i].Value
+		if path == "" && key == "version" {
+			continue
+		}
+
+		keyPath := joinConfigPath(path, key)
+		incomingValue := incoming.Content[i+1]
+		localValue := mappingValue(local, key)
+
+		if localValue == nil {
+			local.Content = append(local.Content, incoming.Content[i], incomingValue)
+			continue
+		}
+		// Empty values are only encoded when a profile sets them on purpose, so
+		// only a missing block is taken as it is
+		if localValue.ShortTag() == "!!null" {
+			*localValue = *incomingValue
+			continue
+		}
+		if localValue.Kind == yaml.MappingNode && incomingValue.Kind == yaml.MappingNode {
+			err := m.merge(localValue, incomingValue, keyPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if renderYamlValue(localValue) == renderYamlValue(incomingValue) {
+			continue
+		}
+
+		takeIncoming, err := m.resolve(keyPath, localValue, incomingValue)
+		if err != nil {
+			return err
+		}
+		if takeIncoming {
+			*localValue = *incomingValue
+		}
+	}
+	return nil
+}
+
+// resolve decides whether the incoming value replaces the local one
+func (m *configMerger) resolve(path string, local *yaml.Node, incoming *yaml.Node) (bool, error) {
+	switch m.strategy {
+	case mergeKeepLocal:
+		return false, nil
+	case mergeTakeIncoming:
+		return true, nil
+	}
+
+	if m.dryRun {
+		m.undecided = append(m.undecided, fmt.Sprintf("%s: %s (local) or %s (incoming)", path, renderYamlValue(local), renderYamlValue(incoming)))
+		return false, nil
+	}
+
+	options := []string{
+		fmt.Sprintf("Keep local: %s", renderYamlValue(local)),
+		fmt.Sprintf("Take incoming: %s", renderYamlValue(incoming)),
+	}
+	index, _, err := m.prompter.Select(fmt.Sprintf("%s differs", path), options, nil)
+	if err != nil {
+		return false, err
+	}
+	return index == 1, nil
+}
+
+// selectProfiles returns the file with only the profiles and the identity and
+// defaults blocks they inherit from. Blocks can also be in the local file the
+// profiles are merged into, but a profile naming a block neither has fails
+func (f *configurationFile) selectProfiles(profiles []string, local *configurationFile) (*configurationFile, error) {
+	selected := &configurationFile{
+		Version: f.Version,
+		Configs: make(map[string]*configuration),
+	}
+
+	blocks := &configurationFile{
+		Identities: make(map[string]*identity),
+		Defaults:   make(map[string]*configuration),
+	}
+	for _, file := range []*configurationFile{local, f} {
+		if file == nil {
+			continue
+		}
+		for name, block := range file.Identities {
+			blocks.Identities[name] = block
+		}
+		for name, block := range file.Defaults {
+			blocks.Defaults[name] = block
+		}
+	}
+
+	for _, profile := range profiles {
+		config, ok := f.Configs[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %s does not exist", profile)
+		}
+		selected.Configs[profile] = config
+		if config == nil {
+			continue
+		}
+
+		_, err := blocks.layers(config)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", profile, err)
+		}
+
+		identityName := config.Identity
+		if defaults := f.Defaults[config.Defaults]; defaults != nil {
+			if selected.Defaults == nil {
+				selected.Defaults = make(map[string]*configuration)
+			}
+			selected.Defaults[config.Defaults] = defaults
+
+			if identityName == "" {
+				identityName = defaults.Identity
+			}
+		}
+
+		if inherited := f.Identities[identityName]; inherited != nil {
+			if selected.Identities == nil {
+				selected.Identities = make(map[string]*identity)
+			}
+			selected.Identities[identityName] = inherited
+		}
+	}
+
+	return selected, nil
+}
+
+// validateImport checks the config file an import is about to save, so a
+// merge that leaves a profile naming a block that doesn't exist, or with an
+// invalid value, isn't saved
+func validateImport(f *configurationFile) error {
+	_, errs := f.resolvedConfigs()
+	if len(errs) > 0 {
+		var problems []string
+		for _, err := range errs {
+			problems = append(problems, err.Error())
+		}
+		return fmt.Errorf("the imported config can't be loaded:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	root := &yaml.Node{}
+	err := root.Encode(f)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, problem := range validateConfigNode(root) {
+		if problem.severity == problemError {
+			problems = append(problems, fmt.Sprintf("%s: %s", problem.path, problem.message))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the imported config has invalid values:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// printConfigDiff prints the values that differ between the config files
+func printConfigDiff(before *configurationFile, after *configurationFile) error {
+	beforeValues, err := flattenConfigurationFile(before)
+	if err != nil {
+		return err
+	}
+	afterValues, err := flattenConfigurationFile(after)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool)
+	for path := range beforeValues {
+		paths[path] = true
+	}
+	for path := range afterValues {
+		paths[path] = true
+	}
+
+	var sorted []string
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	changes := 0
+	for _, path := range sorted {
+		beforeValue, inBefore := beforeValues[path]
+		afterValue, inAfter := afterValues[path]
+
+		switch {
+		case !inBefore:
+			fmt.Printf("  + %s: %s\n", path, afterValue)
+		case !inAfter:
+			fmt.Printf("  - %s: %s\n", path, beforeValue)
+		case beforeValue != afterValue:
+			fmt.Printf("  ~ %s: %s -> %s\n", path, beforeValue, afterValue)
+		default:
+			continue
+		}
+		changes++
+	}
+
+	if changes == 0 {
+		fmt.Println("  Nothing would change")
+	}
+	return nil
+}
+
+// flattenConfigurationFile returns the values of the file by their path, like
+// configs.prod.region
+func flattenConfigurationFile(f *configurationFile) (map[string]string, error) {
+	values := make(map[string]string)
+	if f == nil {
+		return values, nil
+	}
+
+	node := &yaml.Node{}
+	err := node.Encode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	flattenYaml(node, "", values)
+	delete(values, "version")
+	return values, nil
+}
+
+func flattenYaml(node *yaml.Node, path string, values map[string]string) {
+	if node.Kind != yaml.MappingNode {
+		if !isEmptyYamlValue(node) {
+			values[path] = renderYamlValue(node)
+		}
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		flattenYaml(node.Content[i+1], joinConfigPath(path, node.Content[i].Value), values)
+	}
+}
+
+// renderYamlValue returns a value on one line, with lists in flow style
+func renderYamlValue(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+
+	flow := *node
+	flow.Style = yaml.FlowStyle
+	content, err := yaml.Marshal(&flow)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// backupConfigFile copies the config file to a timestamped backup next to it
+// and removes the oldest backups beyond maxConfigBackups
+func backupConfigFile() (string, error) {
+	content, err := os.ReadFile(defaultConfigLocation)
+	if err != nil {
+		return "", err
+	}
+
+	backupPath, err := backupFile(defaultConfigLocation, content, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	// Backups of migrations are named by version, which has no dash
+	backups, err := filepath.Glob(defaultConfigLocation + ".*-*.bkp")
+	if err != nil {
+		return backupPath, nil
+	}
+	sort.Strings(backups)
+	for len(backups) > maxConfigBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+
+	return backupPath, nil
+}
+
+// backupFile writes the content of the file next to it, named by the time
+func backupFile(path string, content []byte, mode os.FileMode) (string, error) {
+	backupPath := fmt.Sprintf("%s.%s.bkp", path, time.Now().Format(configBackupTimeFormat))
+	err := os.WriteFile(backupPath, content, mode)
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", path, err)
+	}
+	return backupPath, nil
+}
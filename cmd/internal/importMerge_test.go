@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const localMergeConfig = `version: 1.1.0
+identities:
+  work:
+    idp: azure
+    azure_tenant_id: tenant-local
+configs:
+  prod:
+    identity: work
+    region: eu-west-1
+    browser_args: [--incognito]
+  local-only:
+    region: us-east-1
+`
+
+const incomingMergeConfig = `version: 1.1.0
+identities:
+  work:
+    idp: azure
+    azure_tenant_id: tenant-incoming
+configs:
+  prod:
+    identity: work
+    region: us-west-2
+    browser_args: [--incognito]
+    destination_role_name: Admin
+  incoming-only:
+    region: eu-central-1
+`
+
+func TestMergeConfigurationFiles(t *testing.T) {
+	tests := []struct {
+		strategy      string
+		dryRun        bool
+		wantTenant    string
+		wantRegion    string
+		wantUndecided []string
+	}{
+		{
+			strategy:   mergeKeepLocal,
+			wantTenant: "tenant-local",
+			wantRegion: "eu-west-1",
+		},
+		{
+			strategy:   mergeTakeIncoming,
+			wantTenant: "tenant-incoming",
+			wantRegion: "us-west-2",
+		},
+		{
+			strategy:   mergePrompt,
+			dryRun:     true,
+			wantTenant: "tenant-local",
+			wantRegion: "eu-west-1",
+			wantUndecided: []string{
+				"identities.work.azure_tenant_id: tenant-local (local) or tenant-incoming (incoming)",
+				"configs.prod.region: eu-west-1 (local) or us-west-2 (incoming)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			local := readConfigFile(t, localMergeConfig)
+			incoming := readConfigFile(t, incomingMergeConfig)
+
+			merged, undecided, err := mergeConfigurationFiles(local, incoming, tt.strategy, tt.dryRun)
+			if err != nil {
+				t.Fatalf("mergeConfigurationFiles() error = %v", err)
+			}
+
+			if got := merged.Identities["work"].AzureTenantId; got != tt.wantTenant {
+				t.Errorf("merged tenant = %s, want %s", got, tt.wantTenant)
+			}
+			prod := merged.Configs["prod"]
+			if prod.Region != tt.wantRegion {
+				t.Errorf("merged region = %s, want %s", prod.Region, tt.wantRegion)
+			}
+			if prod.DestinationRoleName != "Admin" {
+				t.Errorf("merged prod didn't take the incoming role name, got %+v", prod)
+			}
+			if !reflect.DeepEqual(prod.BrowserArgs, []string{"--incognito"}) {
+				t.Errorf("merged browser args = %v", prod.BrowserArgs)
+			}
+
+			var profiles []string
+			for profile := range merged.Configs {
+				profiles = append(profiles, profile)
+			}
+			sort.Strings(profiles)
+			if want := []string{"incoming-only", "local-only", "prod"}; !reflect.DeepEqual(profiles, want) {
+				t.Errorf("merged profiles = %v, want %v", profiles, want)
+			}
+
+			if !reflect.DeepEqual(undecided, tt.wantUndecided) {
+				t.Errorf("undecided = %q, want %q", undecided, tt.wantUndecided)
+			}
+		})
+	}
+}
+
+func TestConfigMergerMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    string
+		incoming string
+		want     string
+	}{
+		{
+			name:     "missing blocks are taken",
+			local:    "configs:\n  prod:\n",
+			incoming: "configs:\n  prod:\n    region: us-east-1\n",
+			want:     "configs:\n    prod:\n        region: us-east-1\n",
+		},
+		{
+			name:     "empty values set on purpose conflict",
+			local:    "configs:\n  prod:\n    remember_me: false\n",
+			incoming: "configs:\n  prod:\n    remember_me: true\n",
+			want:     "configs:\n    prod:\n        remember_me: false\n",
+		},
+		{
+			name:     "the version isn't merged",
+			local:    "version: 1.1.0\n",
+			incoming: "version: 1.0.0\n",
+			want:     "version: 1.1.0\n",
+		},
+		{
+			name:     "lists are compared as a whole",
+			local:    "browser_args: [--a, --b]\n",
+			incoming: "browser_args: [--a]\n",
+			want:     "browser_args: [--a, --b]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := yaml.Node{}
+			incoming := yaml.Node{}
+			if err := yaml.Unmarshal([]byte(tt.local), &local); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(tt.incoming), &incoming); err != nil {
+				t.Fatal(err)
+			}
+
+			merger := &configMerger{strategy: mergeKeepLocal}
+			if err := merger.merge(local.Content[0], incoming.Content[0], ""); err != nil {
+				t.Fatalf("merge() error = %v", err)
+			}
+
+			content, err := yaml.Marshal(local.Content[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("merge() =\n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectProfiles(t *testing.T) {
+	incoming := readConfigFile(t, `version: 1.1.0
+identities:
+  work:
+    idp: okta
+  unused:
+    idp: azure
+defaults:
+  team:
+    identity: work
+configs:
+  prod:
+    defaults: team
+  staging:
+    identity: shared
+  broken:
+    identity: nowhere
+`)
+	local := readConfigFile(t, "version: 1.1.0\nidentities:\n  shared:\n    idp: azure\nconfigs: {}\n")
+
+	tests := []struct {
+		name           string
+		profiles       []string
+		local          *configurationFile
+		wantIdentities []string
+		wantDefaults   []string
+		wantErr        string
+	}{
+		{
+			name:           "blocks the profiles inherit from are kept",
+			profiles:       []string{"prod"},
+			wantIdentities: []string{"work"},
+			wantDefaults:   []string{"team"},
+		},
+		{
+			name:     "blocks can be in the local file",
+			profiles: []string{"staging"},
+			local:    local,
+		},
+		{
+			name:     "blocks in neither file",
+			profiles: []string{"staging"},
+			wantErr:  "profile staging: the identity shared doesn't exist",
+		},
+		{
+			name:     "blocks that don't exist anywhere",
+			profiles: []string{"prod", "broken"},
+			local:    local,
+			wantErr:  "profile broken: the identity nowhere doesn't exist",
+		},
+		{
+			name:     "profiles that don't exist",
+			profiles: []string{"dev"},
+			wantErr:  "profile dev does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := incoming.selectProfiles(tt.profiles, tt.local)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("selectProfiles() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectProfiles() error = %v", err)
+			}
+
+			if len(selected.Configs) != len(tt.profiles) {
+				t.Errorf("selectProfiles() profiles = %v, want %v", selected.Configs, tt.profiles)
+			}
+
+			var identities, defaults []string
+			for name := range selected.Identities {
+				identities = append(identities, name)
+			}
+			for name := range selected.Defaults {
+				defaults = append(defaults, name)
+			}
+			if !reflect.DeepEqual(identities, tt.wantIdentities) || !reflect.DeepEqual(defaults, tt.wantDefaults) {
+				t.Errorf("selectProfiles() blocks = %v and %v, want %v and %v", identities, defaults, tt.wantIdentities, tt.wantDefaults)
+			}
+		})
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			content: "version: 1.1.0\nconfigs:\n  prod:\n    region: eu-west-1\n",
+		},
+		{
+			name:    "blocks that don't exist",
+			content: "version: 1.1.0\nconfigs:\n  prod:\n    defaults: team\n",
+			wantErr: "the imported config can't be loaded:\n  profile prod: the defaults team don't exist",
+		},
+		{
+			name:    "invalid values",
+			content: "version: 1.1.0\nconfigs:\n  prod:\n    destination_account_id: \"1234\"\n",
+			wantErr: "the imported config has invalid values:\n  configs.prod.destination_account_id: 1234 isn't 12 digits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateImport(readConfigFile(t, tt.content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateImport() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("validateImport() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
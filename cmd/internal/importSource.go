@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultGitConfigPath is the file imported from a git repository when the
+// source doesn't name one
+const defaultGitConfigPath = "awsure.yml"
+
+// maxRemoteConfigSize limits how much of a downloaded config is read
+const maxRemoteConfigSize = 1 << 20
+
+// IsRemoteSource reports if the source to import from is a url or a git
+// repository rather than a local file
+func IsRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "https://") ||
+		strings.HasPrefix(source, "http://") ||
+		isGitSource(source)
+}
+
+// isGitSource matches git::<url>, git@host:repo and urls of repositories
+// ending in .git, optionally followed by //path/in/repo and ?ref=branch
+func isGitSource(source string) bool {
+	if strings.HasPrefix(source, "git::") || strings.HasPrefix(source, "git@") || strings.HasPrefix(source, "ssh://") {
+		return true
+	}
+
+	repository, _, _ := splitGitSource(source)
+	return strings.Contains(source, "://") && strings.HasSuffix(repository, ".git")
+}
+
+// fetchImportSource returns the path of a local copy of the source, fetched
+// through the proxy and with the ca bundle of the settings. The returned
+// cleanup function removes the copy and should be deferred
+func fetchImportSource(ctx context.Context, source string, settings browserSettings) (string, func(), error) {
+	noCleanup := func() {}
+
+	switch {
+	case isGitSource(source):
+		return cloneConfigFile(ctx, source, settings)
+	case strings.HasPrefix(source, "http://"):
+		return "", nil, fmt.Errorf("%s isn't secure. only https urls can be imported", source)
+	case strings.HasPrefix(source, "https://"):
+		return downloadConfigFile(ctx, source, settings)
+	}
+
+	stat, err := os.Stat(source)
+	if err != nil {
+		return "", nil, err
+	}
+	if stat.IsDir() {
+		return "", nil, fmt.Errorf("%s is a directory. please provide a valid config file", source)
+	}
+	return source, noCleanup, nil
+}
+
+func downloadConfigFile(ctx context.Context, source string, settings browserSettings) (string, func(), error) {
+	client, err := newHttpClient(settings)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid url %s: %v", source, err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to download %s: %v", source, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("failed to download %s: %s", source, res.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(res.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to download %s: %v", source, err)
+	}
+	if len(content) > maxRemoteConfigSize {
+		return "", nil, fmt.Errorf("%s is too large to be a config file", source)
+	}
+
+	file, err := os.CreateTemp("", "awsure-import-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.Remove(file.Name())
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return file.Name(), cleanup, nil
+}
+
+func cloneConfigFile(ctx context.Context, source string, settings browserSettings) (string, func(), error) {
+	repository, path, ref := splitGitSource(strings.TrimPrefix(source, "git::"))
+	if path == "" {
+		path = defaultGitConfigPath
+	}
+
+	directory, err := os.MkdirTemp("", "awsure-import-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(directory)
+	}
+
+	output, err := gitCloneCommand(ctx, repository, ref, directory, settings).CombinedOutput()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to clone %s: %v\n%s", repository, err, strings.TrimSpace(string(output)))
+	}
+
+	configPath := filepath.Join(directory, filepath.FromSlash(path))
+	if !strings.HasPrefix(configPath, directory+string(filepath.Separator)) {
+		cleanup()
+		return "", nil, fmt.Errorf("%s is outside of the repository", path)
+	}
+
+	stat, err := os.Stat(configPath)
+	if err != nil || stat.IsDir() {
+		cleanup()
+		return "", nil, fmt.Errorf("%s has no config file at %s", repository, path)
+	}
+
+	return configPath, cleanup, nil
+}
+
+// gitCloneCommand clones the repository with the proxy and ca bundle of the
+// settings. The proxy is given in the environment of git, as its arguments,
+// with the credentials of the proxy, can be seen by every user
+func gitCloneCommand(ctx context.Context, repository string, ref string, directory string, settings browserSettings) *exec.Cmd {
+	var args []string
+	if settings.caBundle != "" {
+		args = append(args, "-c", "http.sslCAInfo="+settings.caBundle)
+	}
+	args = append(args, "clone", "--quiet", "--depth", "1")
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repository, directory)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if settings.proxy != "" {
+		cmd.Env = append(os.Environ(), "http_proxy="+settings.proxy, "https_proxy="+settings.proxy, "HTTPS_PROXY="+settings.proxy)
+	}
+	return cmd
+}
+
+// splitGitSource splits repo//path/in/repo?ref=branch into its parts
+func splitGitSource(source string) (string, string, string) {
+	ref := ""
+	if i := strings.LastIndex(source, "?"); i >= 0 {
+		query, err := url.ParseQuery(source[i+1:])
+		if err == nil {
+			ref = query.Get("ref")
+			source = source[:i]
+		}
+	}
+
+	start := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		start = i + len("://")
+	}
+
+	path := ""
+	if i := strings.Index(source[start:], "//"); i >= 0 {
+		path = source[start+i+2:]
+		source = source[:start+i]
+	}
+
+	return source, path, ref
+}
@@ -10,6 +10,12 @@ var homeDir string
 var defaultConfigLocation string
 var defaultAwsCredentialsFileLocation string
 var defaultJumpRoleCredentialsFileLocation string
+var defaultDebugDirectory string
+var defaultCustomStatesLocation string
+var defaultBrowserProfilesDirectory string
+var defaultSamlMetadataDirectory string
+var defaultAccountAliasesLocation string
+var defaultCachedRolesLocation string
 var timeFormat string
 
 func init() {
@@ -23,5 +29,11 @@ func init() {
 	defaultConfigLocation = filepath.Join(homeDir, ".config", "awsure", "config.yml")
 	defaultAwsCredentialsFileLocation = filepath.Join(homeDir, ".aws", "credentials")
 	defaultJumpRoleCredentialsFileLocation = filepath.Join(homeDir, ".config", "awsure", "jump-role-credentials.yml")
+	defaultDebugDirectory = filepath.Join(homeDir, ".config", "awsure", "debug")
+	defaultCustomStatesLocation = filepath.Join(homeDir, ".config", "awsure", "states.yml")
+	defaultBrowserProfilesDirectory = filepath.Join(homeDir, ".config", "awsure", "browser")
+	defaultSamlMetadataDirectory = filepath.Join(homeDir, ".config", "awsure", "metadata")
+	defaultAccountAliasesLocation = filepath.Join(homeDir, ".config", "awsure", "accounts.yml")
+	defaultCachedRolesLocation = filepath.Join(homeDir, ".config", "awsure", "roles.yml")
 	timeFormat = time.RFC3339
 }
@@ -5,7 +5,6 @@ import (
 	"compress/flate"
 	"context"
 	"encoding/base64"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,9 +12,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
 	"github.com/google/uuid"
+	"github.com/vahid-haghighat/awsure/cmd/types"
 	"gopkg.in/ini.v1"
 	"log"
 	"net/url"
@@ -31,27 +30,54 @@ const (
 	AwsSamlEndpoint = "https://signin.aws.amazon.com/saml"
 )
 
-func LoginAll(gui bool) error {
+const (
+	idpAzure = "azure"
+	idpOkta  = "okta"
+)
+
+const (
+	authModeBrowser       = "browser"
+	authModeDeviceCode    = "device_code"
+	authModeSystemBrowser = "system_browser"
+)
+
+func LoginAll(ctx context.Context, options types.Configuration) error {
 	configs, err := loadConfigs()
-	if err != nil {
+	if errors.Is(err, fileNotFoundError) {
 		return fmt.Errorf("we couldn't find any config files. please run 'awsure config --profile [PROFILE_NAME]' to configure")
 	}
+	if err != nil {
+		return err
+	}
+
+	effectiveConfigs := make(map[string]*configuration, len(configs))
+	for profile, config := range configs {
+		effectiveConfigs[profile], err = effectiveConfig(config, options)
+		if err != nil {
+			return fmt.Errorf("profile %s: %v", profile, err)
+		}
+	}
 
 	samls := make(map[string]string)
 
 	jumpRoles, err := loadJumpRoleCredentials()
+	loginToOkta := errors.Is(err, fileNotFoundError)
+	if loginToOkta {
+		jumpRoles = make(map[string]*jumpRoleCredentials)
+	} else if err != nil {
+		return err
+	}
 	now := time.Now()
-	loginToOkta := false
 	for _, j := range jumpRoles {
 		if !j.AwsExpiration.After(now) {
 			loginToOkta = true
 		}
 	}
-	if errors.Is(err, fileNotFoundError) || loginToOkta {
-		for profile, config := range configs {
+	if loginToOkta {
+		for profile, config := range effectiveConfigs {
 			h := config.Hash()
 			if _, ok := samls[h]; !ok {
-				samls[h], err = getSaml(config, gui)
+				samls[h], err = getSaml(ctx, config, options)
 				if err != nil {
 					return err
 				}
@@ -59,15 +85,11 @@ func LoginAll(gui bool) error {
 
 			var jumpRole *role
 			loggedInJumpRole := jumpRoles[config.DefaultJumpRole]
-			jumpRole, loggedInJumpRole, err = loginToJumpRole(config, samls[h])
+			jumpRole, loggedInJumpRole, err = loginToJumpRole(ctx, config, samls[h])
 			if err != nil {
 				return err
 			}
-			if jumpRole.roleArn != config.DefaultJumpRole {
-				config.DefaultJumpRole = jumpRole.roleArn
-				configs[profile] = config
-				_ = saveConfig(configs)
-			}
+			rememberJumpRole(configs, profile, config, jumpRole.roleArn)
 			jumpRoles[jumpRole.roleArn] = loggedInJumpRole
 			err = saveJumpRoleCredentials(jumpRoles)
 			if err != nil {
@@ -77,9 +99,9 @@ func LoginAll(gui bool) error {
 	}
 
 	var errs []string
-	for profile, _ := range configs {
-		config := configs[profile]
-		err = sharedLogin(profile, jumpRoles[config.DefaultJumpRole], config)
+	for profile, _ := range effectiveConfigs {
+		config := effectiveConfigs[profile]
+		err = sharedLogin(ctx, profile, jumpRoles[config.DefaultJumpRole], config)
 		if err != nil {
 			errs = append(errs, err.Error())
 		}
@@ -91,70 +113,106 @@ func LoginAll(gui bool) error {
 	return nil
 }
 
-func getSaml(config *configuration, gui bool) (string, error) {
-	loginUrl, err := createLoginUrl(config.AzureAppIdUri, config.AzureTenantId, AwsSamlEndpoint)
+func getSaml(ctx context.Context, config *configuration, options types.Configuration) (string, error) {
+	saml, err := requestSaml(ctx, config, options)
+	if err != nil {
+		return "", err
+	}
+
+	err = verifySaml(ctx, config, options, saml)
+	if err != nil {
+		return "", friendlyLoginError(err)
+	}
+
+	return saml, nil
+}
+
+// requestSaml logs in to the identity provider with the auth mode of the
+// profile and returns the SAML response for AWS
+func requestSaml(ctx context.Context, config *configuration, options types.Configuration) (string, error) {
+	if config.Idp == idpOkta {
+		saml, err := loginOkta(ctx, config, options)
+		return saml, friendlyLoginError(err)
+	}
+
+	switch config.AuthMode {
+	case "", authModeBrowser:
+	case authModeDeviceCode:
+		saml, err := loginDeviceCode(ctx, config, options)
+		return saml, friendlyLoginError(err)
+	case authModeSystemBrowser:
+		saml, err := loginSystemBrowser(ctx, config, options)
+		return saml, friendlyLoginError(err)
+	default:
+		return "", fmt.Errorf("unknown auth mode %s", config.AuthMode)
+	}
+
+	loginUrl, _, err := createLoginUrl(config.AzureAppIdUri, config.AzureTenantId, AwsSamlEndpoint, "")
 	if err != nil {
 		return "", err
 	}
 	var saml string
-	if gui {
-		saml, err = loginGui(loginUrl, config)
+	if options.Visible {
+		saml, err = loginGui(ctx, loginUrl, config, options)
 	} else {
-		saml, err = loginCli(loginUrl, config)
+		saml, err = loginCli(ctx, loginUrl, config, options)
 	}
 	if err != nil {
-		return "", err
+		return "", friendlyLoginError(err)
 	}
 	return saml, nil
 }
 
-func Login(profile string, configs map[string]*configuration, gui bool) error {
+func Login(ctx context.Context, profile string, configs map[string]*configuration, options types.Configuration) error {
 	if configs == nil {
 		var err error
 		configs, err = loadConfigs()
-		if err != nil {
+		if errors.Is(err, fileNotFoundError) {
 			fmt.Println("We couldn't find any config files. Let's take care of that first")
 			err = ConfigProfile(profile)
 			if err != nil {
 				return err
 			}
 			configs, err = loadConfigs()
-			if err != nil {
-				return err
-			}
+		}
+		if err != nil {
+			return err
 		}
 	}
 
-	config, foundConfig := configs[profile]
+	profileConfig, foundConfig := configs[profile]
 	if !foundConfig {
 		return fmt.Errorf("profile %s does not exist", profile)
 	}
 
+	config, err := effectiveConfig(profileConfig, options)
+	if err != nil {
+		return err
+	}
+
 	jumpRoles, err := loadJumpRoleCredentials()
 	if errors.Is(err, fileNotFoundError) {
 		jumpRoles = make(map[string]*jumpRoleCredentials)
 		jumpRoles[config.DefaultJumpRole] = &jumpRoleCredentials{}
+	} else if err != nil {
+		return err
 	}
 	loggedInJumpRole := jumpRoles[config.DefaultJumpRole]
 	now := time.Now()
 
 	if loggedInJumpRole == nil || !loggedInJumpRole.AwsExpiration.After(now) {
 		var saml string
-		saml, err = getSaml(config, gui)
+		saml, err = getSaml(ctx, config, options)
 		if err != nil {
 			return err
 		}
 
 		var jumpRole *role
-		jumpRole, loggedInJumpRole, err = loginToJumpRole(config, saml)
+		jumpRole, loggedInJumpRole, err = loginToJumpRole(ctx, config, saml)
 		if err != nil {
 			return err
 		}
-		if jumpRole.roleArn != config.DefaultJumpRole {
-			config.DefaultJumpRole = jumpRole.roleArn
-			configs[profile] = config
-			_ = saveConfig(configs)
-		}
+		rememberJumpRole(configs, profile, config, jumpRole.roleArn)
 		jumpRoles[jumpRole.roleArn] = loggedInJumpRole
 		err = saveJumpRoleCredentials(jumpRoles)
 		if err != nil {
@@ -162,27 +220,64 @@ func Login(profile string, configs map[string]*configuration, gui bool) error {
 		}
 	}
 
-	return sharedLogin(profile, loggedInJumpRole, config)
+	return sharedLogin(ctx, profile, loggedInJumpRole, config)
 }
 
-func sharedLogin(profile string, loggedInJumpRole *jumpRoleCredentials, config *configuration) error {
-	fmt.Printf("Logging in with profile %s\n", profile)
+// rememberJumpRole saves the jump role chosen at login as the default of the
+// profile, unless the jump role was given outside the config file
+func rememberJumpRole(configs map[string]*configuration, profile string, config *configuration, jumpRoleArn string) {
+	if jumpRoleArn == config.DefaultJumpRole {
+		return
+	}
+
+	if configs[profile].DefaultJumpRole == config.DefaultJumpRole {
+		configs[profile].DefaultJumpRole = jumpRoleArn
+		_ = saveConfig(configs)
+	}
+	config.DefaultJumpRole = jumpRoleArn
+}
 
-	awsConfig, err := cfg.LoadDefaultConfig(context.Background(), cfg.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(loggedInJumpRole.AwsAccessKeyId, loggedInJumpRole.AwsSecretAccessKey, loggedInJumpRole.AwsSessionToken)))
+func Logout(profile string, all bool) error {
+	if all {
+		err := os.RemoveAll(defaultBrowserProfilesDirectory)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Removed the browser sessions of all profiles")
+		return nil
+	}
+
+	configs, err := loadConfigs()
+	if errors.Is(err, fileNotFoundError) {
+		return fmt.Errorf("we couldn't find any config files. please run 'awsure config --profile [PROFILE_NAME]' to configure")
+	}
 	if err != nil {
 		return err
 	}
-	if awsConfig.Region == "" {
-		awsConfig.Region = config.Region
+
+	config, foundConfig := configs[profile]
+	if !foundConfig {
+		return fmt.Errorf("profile %s does not exist", profile)
 	}
 
-	stsClient := sts.NewFromConfig(awsConfig)
-	destinationRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", config.DestinationAccountId, config.DestinationRoleName)
-	stsInput := sts.AssumeRoleInput{
-		RoleArn:         &destinationRoleArn,
-		RoleSessionName: &profile,
+	err = os.RemoveAll(browserProfileDirectory(config))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed the browser session used by %s profile\n", profile)
+	return nil
+}
+
+func sharedLogin(ctx context.Context, profile string, loggedInJumpRole *jumpRoleCredentials, config *configuration) error {
+	if loggedInJumpRole.RoleSessionName != "" {
+		fmt.Printf("Logging in with profile %s as %s\n", profile, loggedInJumpRole.RoleSessionName)
+	} else {
+		fmt.Printf("Logging in with profile %s\n", profile)
 	}
-	awsCredentialsResponse, err := stsClient.AssumeRole(context.Background(), &stsInput)
+
+	destinationCredentials, err := destinationRoleCredentials(ctx, profile, loggedInJumpRole, config)
 	if err != nil {
 		return err
 	}
@@ -197,21 +292,57 @@ func sharedLogin(profile string, loggedInJumpRole *jumpRoleCredentials, config *
 		awsCredentials = ini.Empty()
 	}
 	section := awsCredentials.Section(profile)
-	section.Key("aws_access_key_id").SetValue(*awsCredentialsResponse.Credentials.AccessKeyId)
-	section.Key("aws_secret_access_key").SetValue(*awsCredentialsResponse.Credentials.SecretAccessKey)
-	section.Key("aws_session_token").SetValue(*awsCredentialsResponse.Credentials.SessionToken)
+	section.Key("aws_access_key_id").SetValue(destinationCredentials.AwsAccessKeyId)
+	section.Key("aws_secret_access_key").SetValue(destinationCredentials.AwsSecretAccessKey)
+	section.Key("aws_session_token").SetValue(destinationCredentials.AwsSessionToken)
 	section.Key("region").SetValue(config.Region)
 	section.Key("output").SetValue("json")
-	section.Key("aws_expiration").SetValue(awsCredentialsResponse.Credentials.Expiration.Format(timeFormat))
+	section.Key("aws_expiration").SetValue(destinationCredentials.AwsExpiration.Format(timeFormat))
 
 	if err = awsCredentials.SaveTo(defaultAwsCredentialsFileLocation); err != nil {
 		return err
 	}
 
-	fmt.Printf("Credentials expire at: %s\n\n", awsCredentialsResponse.Credentials.Expiration.Local())
+	fmt.Printf("Credentials expire at: %s\n\n", destinationCredentials.AwsExpiration.Local())
 	return nil
 }
 
+// destinationRoleCredentials assumes the destination role of the profile with
+// the jump role. When the destination is the jump role itself, like the
+// profiles created by `awsure config discover`, its credentials are used as
+// they are
+func destinationRoleCredentials(ctx context.Context, profile string, loggedInJumpRole *jumpRoleCredentials, config *configuration) (*jumpRoleCredentials, error) {
+	destinationRoleArn := fmt.Sprintf("arn:aws:iam::%s:role/%s", config.DestinationAccountId, config.DestinationRoleName)
+	if destinationRoleArn == config.DefaultJumpRole {
+		return loggedInJumpRole, nil
+	}
+
+	awsConfig, err := cfg.LoadDefaultConfig(ctx, cfg.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(loggedInJumpRole.AwsAccessKeyId, loggedInJumpRole.AwsSecretAccessKey, loggedInJumpRole.AwsSessionToken)))
+	if err != nil {
+		return nil, err
+	}
+	if awsConfig.Region == "" {
+		awsConfig.Region = config.Region
+	}
+
+	stsClient := sts.NewFromConfig(awsConfig)
+	stsInput := sts.AssumeRoleInput{
+		RoleArn:         &destinationRoleArn,
+		RoleSessionName: &profile,
+	}
+	awsCredentialsResponse, err := stsClient.AssumeRole(ctx, &stsInput)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jumpRoleCredentials{
+		AwsAccessKeyId:     *awsCredentialsResponse.Credentials.AccessKeyId,
+		AwsSecretAccessKey: *awsCredentialsResponse.Credentials.SecretAccessKey,
+		AwsSessionToken:    *awsCredentialsResponse.Credentials.SessionToken,
+		AwsExpiration:      *awsCredentialsResponse.Credentials.Expiration,
+	}, nil
+}
+
 func getJumpRole(roles []role, config *configuration, err error) (role, error) {
 	var rl role
 
@@ -235,19 +366,29 @@ func getJumpRole(roles []role, config *configuration, err error) (role, error) {
 		prompter := Prompter{}
 		if (role{} == rl) {
 			var rolesToSelect []string
+			var rolesToSearch []string
 
 			sort.SliceStable(roles, func(i, j int) bool {
 				return roles[i].roleArn < roles[j].roleArn
 			})
 
+			aliases := accountAliases()
 			linePrefix := "#"
 			for i, r := range roles {
-				rolesToSelect = append(rolesToSelect, linePrefix+strconv.Itoa(i+1)+" "+r.roleArn)
+				line := linePrefix + strconv.Itoa(i+1) + " " + roleDisplayName(r.roleArn, aliases)
+				rolesToSelect = append(rolesToSelect, line)
+				// The ARN is searched too, so roles can be found by either form
+				rolesToSearch = append(rolesToSearch, line+" "+r.roleArn)
 			}
-			label := fmt.Sprintf("Select your jump role for %s in %s - Hint: fuzzy search supported. To choose one role directly just enter #{Int}", config.DestinationRoleName, config.DestinationAccountId)
+
+			destinationAccount := config.DestinationAccountId
+			if alias := aliases[destinationAccount]; alias != "" {
+				destinationAccount = fmt.Sprintf("%s (%s)", alias, destinationAccount)
+			}
+			label := fmt.Sprintf("Select your jump role for %s in %s - Hint: fuzzy search supported. To choose one role directly just enter #{Int}", config.DestinationRoleName, destinationAccount)
 
 			var indexChoice int
-			indexChoice, _, err = prompter.Select(label, rolesToSelect, fuzzySearchWithPrefixAnchor(rolesToSelect, linePrefix))
+			indexChoice, _, err = prompter.Select(label, rolesToSelect, fuzzySearchWithPrefixAnchor(rolesToSearch, linePrefix))
 			if err != nil {
 				return role{}, err
 			}
@@ -258,147 +399,224 @@ func getJumpRole(roles []role, config *configuration, err error) (role, error) {
 	return rl, nil
 }
 
-func loginCli(urlString string, conf *configuration) (string, error) {
-	browser := rod.New()
-
-	browser = browser.MustConnect()
-	defer browser.MustClose()
+func loginCli(ctx context.Context, urlString string, conf *configuration, options types.Configuration) (string, error) {
+	errorStates, states, err := loginStates()
+	if err != nil {
+		return "", err
+	}
 
-	router := browser.HijackRequests()
-	defer router.MustStop()
+	ctx, cancel := withLoginTimeout(ctx, options.Timeout)
+	defer cancel()
 
-	samlResponseChan := make(chan string, 1)
-	samlResult := ""
+	browser, cleanup, err := openBrowser(conf, resolveBrowserSettings(conf), true)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
 
-	router.MustAdd("https://*amazon*", func(ctx *rod.Hijack) {
-		reqURL := ctx.Request.URL().String()
+	page, samlResults, stopHijack, err := openLoginPage(ctx, browser, urlString)
+	if err != nil {
+		return "", err
+	}
+	defer stopHijack()
 
-		if reqURL == AwsSamlEndpoint {
-			val, err := url.ParseQuery(ctx.Request.Body())
-			if err != nil {
-				fmt.Printf("Fail to saml endpoint response: %v", err)
-				os.Exit(1)
-			}
+	stopSpinner := startSpinner()
+	defer func() {
+		stopSpinner()
+	}()
 
-			samlResponseChan <- val.Get("SAMLResponse")
+	lastMatch := time.Now()
 
-			ctx.Response.Fail(proto.NetworkErrorReasonInternetDisconnected)
-		} else {
-			ctx.ContinueRequest(&proto.FetchContinueRequest{})
+	for {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
-	})
 
-	go router.Run()
-
-	stopChan := make(chan struct{})
-	go spinner(stopChan)
+		for _, st := range errorStates {
+			el, err := page.Sleeper(rod.NotFoundSleeper).Element(st.Selector())
+			if err != nil {
+				continue
+			}
 
-	page := browser.MustPage()
-	wait := page.WaitNavigation(proto.PageLifecycleEventNameDOMContentLoaded)
-	page.MustNavigate(urlString)
-	wait()
+			err = st.Handle(page, el, conf)
+			if err != nil {
+				return "", err
+			}
+		}
 
-Loop:
-	for {
 		for _, st := range states {
 			select {
-			case x, ok := <-samlResponseChan:
-				if ok {
-					samlResult = x
-					stopChan <- struct{}{}
-					break Loop
-				}
+			case result := <-samlResults:
+				return result.saml, result.err
 			default:
 			}
 
-			el, err := page.Sleeper(rod.NotFoundSleeper).Element(st.selector)
-
-			if err == nil {
-				stopChan <- struct{}{}
+			el, err := page.Sleeper(rod.NotFoundSleeper).Element(st.Selector())
+			if err != nil {
+				continue
+			}
 
-				err = st.handler(page, el, conf)
-				if err != nil {
-					return "", err
-				}
-				stopChan = make(chan struct{})
-				go spinner(stopChan)
-				time.Sleep(time.Millisecond * 500)
+			stopSpinner()
+			err = st.Handle(page, el, conf)
+			if err != nil {
+				return "", err
 			}
+			stopSpinner = startSpinner()
+
+			time.Sleep(time.Millisecond * 500)
+			lastMatch = time.Now()
 		}
-	}
 
-	return samlResult, nil
+		// Like the login timeout, a state timeout of 0 turns it off
+		if options.StateTimeout > 0 && time.Since(lastMatch) > options.StateTimeout {
+			stopSpinner()
+			dumpPage(page)
+			stopSpinner = startSpinner()
+			lastMatch = time.Now()
+		}
+	}
 }
 
-func loginGui(urlString string, conf *configuration) (string, error) {
-	l := launcher.New().
-		Headless(false).
-		Devtools(false)
+func loginGui(ctx context.Context, urlString string, conf *configuration, options types.Configuration) (string, error) {
+	ctx, cancel := withLoginTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	browser, cleanup, err := openBrowser(conf, resolveBrowserSettings(conf), false)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
 
-	defer l.Cleanup()
-	controlUrl := l.MustLaunch()
-	browser := rod.New()
-	browser = browser.ControlURL(controlUrl)
-	browser = browser.MustConnect()
-	defer browser.MustClose()
+	_, samlResults, stopHijack, err := openLoginPage(ctx, browser, urlString)
+	if err != nil {
+		return "", err
+	}
+	defer stopHijack()
 
-	router := browser.HijackRequests()
-	defer router.MustStop()
+	stopSpinner := startSpinner()
+	defer stopSpinner()
 
-	samlResponseChan := make(chan string, 1)
-	samlResult := ""
+	select {
+	case result := <-samlResults:
+		time.Sleep(1 * time.Second)
+		return result.saml, result.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
 
-	router.MustAdd("https://*amazon*", func(ctx *rod.Hijack) {
-		reqURL := ctx.Request.URL().String()
+// openLoginPage opens the login url in a new page bound to ctx. The SAML
+// response is taken from the request the page makes to AWS, which is failed
+// so the browser doesn't sign in to the console. The returned function stops
+// capturing the requests.
+func openLoginPage(ctx context.Context, browser *rod.Browser, urlString string) (*rod.Page, <-chan samlResult, func(), error) {
+	page, err := browser.Context(ctx).Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		if reqURL == AwsSamlEndpoint {
-			val, err := url.ParseQuery(ctx.Request.Body())
-			if err != nil {
-				fmt.Printf("Fail to saml endpoint response: %v", err)
-				os.Exit(1)
-			}
+	samlResults := make(chan samlResult, 1)
 
-			samlResponseChan <- val.Get("SAMLResponse")
+	router := page.HijackRequests()
+	err = router.Add("https://*amazon*", "", func(h *rod.Hijack) {
+		if h.Request.URL().String() != AwsSamlEndpoint {
+			h.ContinueRequest(&proto.FetchContinueRequest{})
+			return
+		}
 
-			ctx.Response.Fail(proto.NetworkErrorReasonInternetDisconnected)
+		result := samlResult{}
+		val, err := url.ParseQuery(h.Request.Body())
+		if err != nil {
+			result.err = fmt.Errorf("failed to read the SAML response: %v", err)
 		} else {
-			ctx.ContinueRequest(&proto.FetchContinueRequest{})
+			result.saml = val.Get("SAMLResponse")
 		}
+
+		select {
+		case samlResults <- result:
+		default:
+		}
+
+		h.Response.Fail(proto.NetworkErrorReasonInternetDisconnected)
 	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	go router.Run()
+	stopHijack := func() {
+		_ = router.Stop()
+	}
 
-	stopChan := make(chan struct{})
-	go spinner(stopChan)
-
-	page := browser.MustPage()
 	wait := page.WaitNavigation(proto.PageLifecycleEventNameDOMContentLoaded)
-	page.MustNavigate(urlString)
+	err = page.Navigate(urlString)
+	if err != nil {
+		stopHijack()
+		return nil, nil, nil, err
+	}
 	wait()
 
-Loop:
-	for {
-		select {
-		case x, ok := <-samlResponseChan:
-			if ok {
-				samlResult = x
-				stopChan <- struct{}{}
-				break Loop
-			}
-		default:
-		}
-		time.Sleep(100 * time.Millisecond)
+	return page, samlResults, stopHijack, nil
+}
+
+// withLoginTimeout limits how long the login can take. A timeout of 0 means
+// there's no limit
+func withLoginTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dumpPage saves the title, url and a screenshot of the page to the debug
+// directory and prints where the login got stuck, so unknown identity provider
+// pages can be added as new states
+func dumpPage(page *rod.Page) {
+	info, err := page.Info()
+	if err != nil {
+		fmt.Printf("No known login page was detected and the page information couldn't be read: %v\n", err)
+		return
+	}
+	fmt.Printf("No known login page was detected. Title: %q, Url: %s\n", info.Title, info.URL)
+
+	err = os.MkdirAll(defaultDebugDirectory, 0700)
+	if err != nil {
+		fmt.Printf("Couldn't create the debug directory: %v\n", err)
+		return
+	}
+
+	name := time.Now().Format("20060102-150405")
+	infoPath := filepath.Join(defaultDebugDirectory, fmt.Sprintf("%s.txt", name))
+	err = os.WriteFile(infoPath, []byte(fmt.Sprintf("Title: %s\nUrl: %s\n", info.Title, info.URL)), 0600)
+	if err != nil {
+		fmt.Printf("Couldn't save the title and url of the page: %v\n", err)
+		return
+	}
+	fmt.Printf("The title and url of the page were saved to %s\n", infoPath)
+
+	screenshot, err := page.Screenshot(true, nil)
+	if err != nil {
+		fmt.Printf("Couldn't take a screenshot of the page: %v\n", err)
+		return
 	}
 
-	time.Sleep(1 * time.Second)
-	return samlResult, nil
+	screenshotPath := filepath.Join(defaultDebugDirectory, fmt.Sprintf("%s.png", name))
+	err = os.WriteFile(screenshotPath, screenshot, 0600)
+	if err != nil {
+		fmt.Printf("Couldn't save the screenshot of the page: %v\n", err)
+		return
+	}
+	fmt.Printf("A screenshot of the page was saved to %s\n", screenshotPath)
 }
 
-func createLoginUrl(appIdUri string, tenantId string, assertionConsumerServiceURL string) (string, error) {
-	id := uuid.NewString()
+// createLoginUrl returns the url that starts the login with a SAML request,
+// and the id of the request, which the SAML response is in response to. A
+// relay state is returned along with the response
+func createLoginUrl(appIdUri string, tenantId string, assertionConsumerServiceURL string, relayState string) (string, string, error) {
+	id := "id" + uuid.NewString()
 
 	samlRequest := fmt.Sprintf(`
-	<samlp:AuthnRequest xmlns="urn:oasis:names:tc:SAML:2.0:metadata" ID="id%s" Version="2.0" IssueInstant="%s" IsPassive="false" AssertionConsumerServiceURL="%s" xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+	<samlp:AuthnRequest xmlns="urn:oasis:names:tc:SAML:2.0:metadata" ID="%s" Version="2.0" IssueInstant="%s" IsPassive="false" AssertionConsumerServiceURL="%s" xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
 		<Issuer xmlns="urn:oasis:names:tc:SAML:2.0:assertion">%s</Issuer>
 		<samlp:NameIDPolicy Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"></samlp:NameIDPolicy>
 	</samlp:AuthnRequest>
@@ -416,63 +634,37 @@ func createLoginUrl(appIdUri string, tenantId string, assertionConsumerServiceUR
 
 	_, err := flateWriter.Write([]byte(samlRequest))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	err = flateWriter.Flush()
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	samlBase64 := base64.StdEncoding.EncodeToString(buffer.Bytes())
 
-	return fmt.Sprintf("https://login.microsoftonline.com/%s/saml2?SAMLRequest=%s", tenantId, url.QueryEscape(samlBase64)), nil
+	loginUrl := fmt.Sprintf("https://login.microsoftonline.com/%s/saml2?SAMLRequest=%s", tenantId, url.QueryEscape(samlBase64))
+	if relayState != "" {
+		loginUrl += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	return loginUrl, id, nil
 }
 
-func parseRolesFromSamlResponse(assertion string) ([]role, error) {
-	b64, err := base64.StdEncoding.DecodeString(assertion)
-
+func loginToJumpRole(ctx context.Context, config *configuration, saml string) (*role, *jumpRoleCredentials, error) {
+	samlResponse, err := decodeSamlResponse(saml)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse roles: %v", err)
+		return nil, nil, err
 	}
 
-	var roles []role
-	var sResponse samlResponse
-
-	err = xml.Unmarshal(b64, &sResponse)
-
+	roles, err := samlResponse.roles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal roles: %v", err)
-	}
-
-	for _, attr := range sResponse.Assertion.AttributeStatement.Attributes {
-		if attr.Name == "https://aws.amazon.com/SAML/Attributes/Role" {
-			for _, val := range attr.AttributeValues {
-				parts := strings.Split(val.Value, ",")
-
-				if strings.Contains(parts[0], ":role/") {
-					roles = append(roles, role{
-						roleArn:      strings.TrimSpace(parts[0]),
-						principalArn: strings.TrimSpace(parts[1]),
-					})
-				} else {
-					roles = append(roles, role{
-						roleArn:      strings.TrimSpace(parts[1]),
-						principalArn: strings.TrimSpace(parts[0]),
-					})
-				}
-
-			}
-		}
+		return nil, nil, err
 	}
 
-	return roles, nil
-}
-
-func loginToJumpRole(config *configuration, saml string) (*role, *jumpRoleCredentials, error) {
-	roles, err := parseRolesFromSamlResponse(saml)
+	err = saveCachedRoles(config, roles)
 	if err != nil {
-		return nil, nil, err
+		warn("couldn't cache the roles for the config wizard: %v", err)
 	}
 
 	rl, err := getJumpRole(roles, config, err)
@@ -481,6 +673,15 @@ func loginToJumpRole(config *configuration, saml string) (*role, *jumpRoleCreden
 	}
 
 	durationSeconds := int32(config.DefaultDurationHours * 3600)
+	maxDurationSeconds, err := samlResponse.sessionDuration()
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxDurationSeconds > 0 && durationSeconds > maxDurationSeconds {
+		warn("the identity provider allows sessions of up to %s, but %d hours was requested. Using %s instead",
+			time.Duration(maxDurationSeconds)*time.Second, config.DefaultDurationHours, time.Duration(maxDurationSeconds)*time.Second)
+		durationSeconds = maxDurationSeconds
+	}
 
 	jumpRoleStsInput := sts.AssumeRoleWithSAMLInput{
 		PrincipalArn:    &rl.principalArn,
@@ -489,7 +690,7 @@ func loginToJumpRole(config *configuration, saml string) (*role, *jumpRoleCreden
 		DurationSeconds: &durationSeconds,
 	}
 
-	awsConfig, err := cfg.LoadDefaultConfig(context.Background())
+	awsConfig, err := cfg.LoadDefaultConfig(ctx)
 	if err != nil {
 		fmt.Println("Couldn't find the aws config for the specified profile. Creating a new one")
 		awsConfig = *aws.NewConfig()
@@ -499,7 +700,7 @@ func loginToJumpRole(config *configuration, saml string) (*role, *jumpRoleCreden
 	}
 
 	jumpRoleClient := sts.NewFromConfig(awsConfig)
-	jumpRoleResult, err := jumpRoleClient.AssumeRoleWithSAML(context.Background(), &jumpRoleStsInput)
+	jumpRoleResult, err := jumpRoleClient.AssumeRoleWithSAML(ctx, &jumpRoleStsInput)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -509,5 +710,6 @@ func loginToJumpRole(config *configuration, saml string) (*role, *jumpRoleCreden
 		AwsSecretAccessKey: *jumpRoleResult.Credentials.SecretAccessKey,
 		AwsSessionToken:    *jumpRoleResult.Credentials.SessionToken,
 		AwsExpiration:      *jumpRoleResult.Credentials.Expiration,
+		RoleSessionName:    samlResponse.roleSessionName(),
 	}, nil
 }
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// initialConfigFileVersion is the version of config files written before the
+// version was checked, which is assumed when a file has none
+const initialConfigFileVersion = "1.0.0"
+
+type configMigration struct {
+	from    string
+	to      string
+	migrate func(root *yaml.Node) error
+}
+
+var configMigrations = map[string]*configMigration{}
+
+// registerConfigMigration adds a migration of config files from one version to
+// the next. Migrations are chained until the file reaches configFileVersion
+func registerConfigMigration(from string, to string, migrate func(root *yaml.Node) error) {
+	configMigrations[from] = &configMigration{
+		from:    from,
+		to:      to,
+		migrate: migrate,
+	}
+}
+
+func init() {
+	registerConfigMigration("1.0.0", "1.1.0", removeEmptyProfileValues)
+}
+
+// removeEmptyProfileValues removes the empty values version 1.0.0 wrote for
+// every setting, as profiles only keep what they set since they can inherit
+// from identity and defaults blocks
+func removeEmptyProfileValues(root *yaml.Node) error {
+	configs := mappingValue(root, "configs")
+	if configs == nil || configs.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 1; i < len(configs.Content); i += 2 {
+		profile := configs.Content[i]
+		if profile.Kind != yaml.MappingNode {
+			continue
+		}
+
+		var content []*yaml.Node
+		for j := 0; j+1 < len(profile.Content); j += 2 {
+			if isEmptyYamlValue(profile.Content[j+1]) {
+				continue
+			}
+			content = append(content, profile.Content[j], profile.Content[j+1])
+		}
+		profile.Content = content
+	}
+
+	return nil
+}
+
+func isEmptyYamlValue(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return true
+		case "!!str":
+			return node.Value == ""
+		case "!!bool":
+			return node.Value == "false"
+		case "!!int":
+			return node.Value == "0"
+		}
+	case yaml.SequenceNode, yaml.MappingNode:
+		return len(node.Content) == 0
+	}
+	return false
+}
+
+// migrateConfigFile checks the version of the config file and migrates older
+// versions to configFileVersion in memory. The file itself is only rewritten
+// when a command saves it, see backupUnmigratedConfigFile
+func migrateConfigFile(path string, root *yaml.Node) error {
+	version := configVersion(root)
+
+	comparison, err := compareVersions(version, configFileVersion)
+	if err != nil {
+		return fmt.Errorf("%s has an invalid version %s: %v", path, version, err)
+	}
+	if comparison > 0 {
+		return fmt.Errorf("%s has version %s, which is newer than this awsure supports (%s). please upgrade awsure", path, version, configFileVersion)
+	}
+	if comparison == 0 {
+		return nil
+	}
+
+	for version != configFileVersion {
+		migration, ok := configMigrations[version]
+		if !ok {
+			return fmt.Errorf("there is no migration of %s from version %s", path, version)
+		}
+
+		err = migration.migrate(root)
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s from version %s to %s: %v", path, migration.from, migration.to, err)
+		}
+		version = migration.to
+	}
+	setMappingValue(root, "version", configFileVersion)
+
+	return nil
+}
+
+// backupUnmigratedConfigFile keeps a copy of the config file at path next to
+// it when it has an older version, before it's saved as configFileVersion
+func backupUnmigratedConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	document := yaml.Node{}
+	err = yaml.Unmarshal(content, &document)
+	if err != nil || len(document.Content) == 0 {
+		return nil
+	}
+
+	version := configVersion(document.Content[0])
+	comparison, err := compareVersions(version, configFileVersion)
+	if err != nil || comparison >= 0 {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bkp", path, version)
+	err = os.WriteFile(backupPath, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to back up %s before migrating it: %v", path, err)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Migrated %s from version %s to %s. The previous file is at %s\n", path, version, configFileVersion, backupPath)
+	return nil
+}
+
+// configVersion returns the version of a config file, which is
+// initialConfigFileVersion for files that have none
+func configVersion(root *yaml.Node) string {
+	if versionNode := mappingValue(root, "version"); versionNode != nil && versionNode.Value != "" {
+		return versionNode.Value
+	}
+	return initialConfigFileVersion
+}
+
+// checkFileVersion refuses files written by a newer awsure, for files that
+// have no migrations
+func checkFileVersion(path string, version string) error {
+	if version == "" {
+		return nil
+	}
+
+	comparison, err := compareVersions(version, configFileVersion)
+	if err != nil {
+		return fmt.Errorf("%s has an invalid version %s: %v", path, version, err)
+	}
+	if comparison > 0 {
+		return fmt.Errorf("%s has version %s, which is newer than this awsure supports (%s). please upgrade awsure", path, version, configFileVersion)
+	}
+	return nil
+}
+
+// compareVersions compares two major.minor.patch versions and returns -1, 0
+// or 1 like strings.Compare
+func compareVersions(a string, b string) (int, error) {
+	aParts, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range aParts {
+		if aParts[i] < bParts[i] {
+			return -1, nil
+		}
+		if aParts[i] > bParts[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([3]int, error) {
+	var parts [3]int
+
+	fields := strings.Split(version, ".")
+	if len(fields) != 3 {
+		return parts, fmt.Errorf("the version should be major.minor.patch")
+	}
+
+	for i, field := range fields {
+		number, err := strconv.Atoi(field)
+		if err != nil || number < 0 {
+			return parts, fmt.Errorf("the version should be major.minor.patch")
+		}
+		parts[i] = number
+	}
+
+	return parts, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key string, value string) {
+	if valueNode := mappingValue(node, key); valueNode != nil {
+		valueNode.Kind = yaml.ScalarNode
+		valueNode.Tag = "!!str"
+		valueNode.Value = value
+		return
+	}
+
+	node.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	}, node.Content...)
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const configVersion100 = `configs:
+  prod:
+    azure_tenant_id: tenant
+    azure_app_id_uri: app
+    azure_username: ""
+    remember_me: false
+    default_duration_hours: 0
+    browser_args: []
+    region: eu-west-1
+`
+
+// useConfigLocation points the config file at a temporary file with the
+// content for the duration of the test
+func useConfigLocation(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := defaultConfigLocation
+	defaultConfigLocation = path
+	t.Cleanup(func() { defaultConfigLocation = previous })
+	return path
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "1.0.0 drops empty profile values",
+			content: configVersion100,
+			want:    "version: 1.1.0\nconfigs:\n    prod:\n        azure_tenant_id: tenant\n        azure_app_id_uri: app\n        region: eu-west-1\n",
+		},
+		{
+			name:    "current version is left as it is",
+			content: "version: 1.1.0\nconfigs:\n  prod:\n    remember_me: false\n",
+			want:    "version: 1.1.0\nconfigs:\n    prod:\n        remember_me: false\n",
+		},
+		{
+			name:    "newer version",
+			content: "version: 9.0.0\nconfigs: {}\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			content: "version: latest\nconfigs: {}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := yaml.Node{}
+			if err := yaml.Unmarshal([]byte(tt.content), &document); err != nil {
+				t.Fatal(err)
+			}
+			root := document.Content[0]
+
+			err := migrateConfigFile("config.yml", root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			content, err := yaml.Marshal(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("migrateConfigFile() =\n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadingDoesNotRewriteOlderConfigFiles(t *testing.T) {
+	path := useConfigLocation(t, configVersion100)
+
+	configFile, err := loadConfigurationFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigurationFile() error = %v", err)
+	}
+	if configFile.Version != configFileVersion {
+		t.Errorf("loadConfigurationFile() version = %s, want %s", configFile.Version, configFileVersion)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != configVersion100 {
+		t.Errorf("loading rewrote the config file:\n%s", content)
+	}
+	if _, err := os.Stat(path + ".1.0.0.bkp"); !os.IsNotExist(err) {
+		t.Errorf("loading made a backup of the config file")
+	}
+}
+
+func TestSavingBacksUpOlderConfigFiles(t *testing.T) {
+	path := useConfigLocation(t, configVersion100)
+
+	configFile, err := loadConfigurationFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigurationFile() error = %v", err)
+	}
+	if err := saveConfigurationFile(configFile); err != nil {
+		t.Fatalf("saveConfigurationFile() error = %v", err)
+	}
+
+	backup, err := os.ReadFile(path + ".1.0.0.bkp")
+	if err != nil {
+		t.Fatalf("saving didn't back up the config file: %v", err)
+	}
+	if string(backup) != configVersion100 {
+		t.Errorf("backup =\n%s\nwant\n%s", backup, configVersion100)
+	}
+
+	// A file of the current version isn't backed up again
+	if err := os.Remove(path + ".1.0.0.bkp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveConfigurationFile(configFile); err != nil {
+		t.Fatalf("saveConfigurationFile() error = %v", err)
+	}
+	matches, _ := filepath.Glob(path + ".*.bkp")
+	if len(matches) != 0 {
+		t.Errorf("saving a current config file made backups %v", matches)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a       string
+		b       string
+		want    int
+		wantErr bool
+	}{
+		{a: "1.0.0", b: "1.1.0", want: -1},
+		{a: "1.1.0", b: "1.1.0", want: 0},
+		{a: "1.10.0", b: "1.9.0", want: 1},
+		{a: "2.0.0", b: "1.99.99", want: 1},
+		{a: "1.0", b: "1.0.0", wantErr: true},
+		{a: "1.0.-1", b: "1.0.0", wantErr: true},
+		{a: "1.0.0", b: "v1.0.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got, err := compareVersions(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compareVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("compareVersions() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckFileVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{version: ""},
+		{version: "1.0.0"},
+		{version: configFileVersion},
+		{version: "99.0.0", wantErr: true},
+		{version: "one", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			err := checkFileVersion("accounts.yml", tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkFileVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	oktaFactorPush = "push"
+	oktaFactorTotp = "token:software:totp"
+)
+
+// oktaPasscodeAttempts is how many times a wrong code can be entered before
+// the login fails
+const oktaPasscodeAttempts = 3
+
+var samlResponseInputRegex = regexp.MustCompile(`(?is)<input[^>]*name="SAMLResponse"[^>]*>`)
+var inputValueRegex = regexp.MustCompile(`(?is)value="([^"]*)"`)
+
+// loginOkta gets the SAML response of an Okta app using Okta's authentication
+// api, without a browser
+func loginOkta(ctx context.Context, config *configuration, options types.Configuration) (string, error) {
+	if config.OktaAppUrl == "" {
+		return "", fmt.Errorf("okta_app_url is required when the identity provider is okta")
+	}
+
+	appUrl, err := url.Parse(config.OktaAppUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid okta app url %s: %v", config.OktaAppUrl, err)
+	}
+	baseUrl := fmt.Sprintf("%s://%s", appUrl.Scheme, appUrl.Host)
+
+	client, err := newHttpClient(resolveBrowserSettings(config))
+	if err != nil {
+		return "", err
+	}
+
+	prompter := Prompter{}
+	username := config.OktaUsername
+	if username == "" {
+		username, err = prompter.Prompt("Okta Username", "")
+		if err != nil {
+			return "", err
+		}
+	}
+	username = strings.TrimSpace(username)
+
+	password, err := prompter.SensitivePrompt("Okta Password")
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := withLoginTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	saml, err := loginOktaAuthn(ctx, client, baseUrl, config.OktaAppUrl, username, password)
+	if err == nil || ctx.Err() != nil || errors.Is(err, accountLockedError) || errors.Is(err, passwordExpiredError) {
+		return saml, err
+	}
+
+	// Orgs on the Okta Identity Engine can turn the classic api off, or have
+	// sign on policies that only the IDX api applies
+	if !oktaUsesIdentityEngine(ctx, client, baseUrl) {
+		return "", err
+	}
+	return newOktaIdxLogin(client, username, password).run(ctx, baseUrl, config.OktaAppUrl)
+}
+
+// loginOktaAuthn logs in with the classic authentication api
+func loginOktaAuthn(ctx context.Context, client *http.Client, baseUrl string, appUrl string, username string, password string) (string, error) {
+	res, err := oktaPost(ctx, client, baseUrl+"/api/v1/authn", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		switch res.Status {
+		case "SUCCESS":
+			return oktaSaml(ctx, client, baseUrl, appUrl, res.SessionToken)
+		case "MFA_REQUIRED":
+			res, err = oktaVerifyFactor(ctx, client, res)
+			if err != nil {
+				return "", err
+			}
+		case "LOCKED_OUT":
+			return "", accountLockedError
+		case "PASSWORD_EXPIRED":
+			return "", passwordExpiredError
+		default:
+			return "", fmt.Errorf("okta returned an unsupported authentication status %s", res.Status)
+		}
+	}
+}
+
+// oktaUsesIdentityEngine reports if the org runs on the Okta Identity Engine,
+// which also offers the IDX api
+func oktaUsesIdentityEngine(ctx context.Context, client *http.Client, baseUrl string) bool {
+	content, err := oktaGet(ctx, client, baseUrl+"/.well-known/okta-organization")
+	if err != nil {
+		return false
+	}
+
+	organization := struct {
+		Pipeline string `json:"pipeline"`
+	}{}
+	err = json.Unmarshal(content, &organization)
+	return err == nil && organization.Pipeline == "idx"
+}
+
+func oktaVerifyFactor(ctx context.Context, client *http.Client, res *oktaAuthnResponse) (*oktaAuthnResponse, error) {
+	var factors []oktaFactor
+	for _, f := range res.Embedded.Factors {
+		if f.FactorType == oktaFactorPush || f.FactorType == oktaFactorTotp {
+			factors = append(factors, f)
+		}
+	}
+
+	if len(factors) == 0 {
+		return nil, fmt.Errorf("none of your okta factors are supported. supported factors are okta verify push and totp")
+	}
+
+	factor := factors[0]
+	if len(factors) > 1 {
+		var items []string
+		for _, f := range factors {
+			items = append(items, oktaFactorName(f))
+		}
+
+		prompter := Prompter{}
+		index, _, err := prompter.Select("Select your MFA factor", items, nil)
+		if err != nil {
+			return nil, err
+		}
+		factor = factors[index]
+	}
+
+	if factor.FactorType == oktaFactorTotp {
+		prompter := Prompter{}
+		for attempt := 1; ; attempt++ {
+			passCode, err := prompter.Prompt(oktaFactorName(factor)+" Code", "")
+			if err != nil {
+				return nil, err
+			}
+
+			verifyRes, err := oktaPost(ctx, client, factor.Links.Verify.Href, map[string]string{
+				"stateToken": res.StateToken,
+				"passCode":   strings.TrimSpace(passCode),
+			})
+			if !errors.Is(err, invalidPasscodeError) || attempt == oktaPasscodeAttempts {
+				return verifyRes, err
+			}
+			fmt.Printf("%v. Please try again\n", err)
+		}
+	}
+
+	verifyRes, err := oktaPost(ctx, client, factor.Links.Verify.Href, map[string]string{
+		"stateToken": res.StateToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("A push notification was sent to Okta Verify")
+	answerShown := false
+	for verifyRes.Status == "MFA_CHALLENGE" {
+		if correctAnswer := verifyRes.Embedded.Factor.Embedded.Challenge.CorrectAnswer; correctAnswer != 0 && !answerShown {
+			fmt.Printf("Select %d in Okta Verify\n", correctAnswer)
+			answerShown = true
+		}
+
+		switch verifyRes.FactorResult {
+		case "REJECTED":
+			return nil, fmt.Errorf("the okta verify push was rejected")
+		case "TIMEOUT":
+			return nil, fmt.Errorf("the okta verify push timed out")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+
+		verifyRes, err = oktaPost(ctx, client, verifyRes.Links.Next.Href, map[string]string{
+			"stateToken": res.StateToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return verifyRes, nil
+}
+
+func oktaFactorName(f oktaFactor) string {
+	switch {
+	case f.FactorType == oktaFactorPush:
+		return "Okta Verify Push"
+	case f.Provider == "GOOGLE":
+		return "Google Authenticator"
+	default:
+		return "Okta Verify"
+	}
+}
+
+func oktaPost(ctx context.Context, client *http.Client, endpoint string, body map[string]string) (*oktaAuthnResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpRes.Body.Close()
+	}()
+
+	content, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &oktaAuthnResponse{}
+	err = json.Unmarshal(content, res)
+
+	if httpRes.StatusCode >= 400 {
+		if err != nil {
+			return nil, fmt.Errorf("okta returned %s", httpRes.Status)
+		}
+		switch res.ErrorCode {
+		case "E0000004":
+			return nil, fmt.Errorf("%w: %s", invalidCredentialsError, res.ErrorSummary)
+		case "E0000068":
+			return nil, fmt.Errorf("%w: %s", invalidPasscodeError, res.ErrorSummary)
+		default:
+			return nil, fmt.Errorf("okta returned %s: %s", httpRes.Status, res.ErrorSummary)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the okta response: %v", err)
+	}
+
+	return res, nil
+}
+
+// oktaSaml exchanges the session token for a session cookie and reads the
+// SAML response from the form the app url returns
+func oktaSaml(ctx context.Context, client *http.Client, baseUrl string, appUrl string, sessionToken string) (string, error) {
+	redirectUrl := fmt.Sprintf("%s/login/sessionCookieRedirect?token=%s&redirectUrl=%s", baseUrl, url.QueryEscape(sessionToken), url.QueryEscape(appUrl))
+	return oktaSamlForm(ctx, client, redirectUrl)
+}
+
+// oktaSamlForm reads the SAML response from the form the url, which ends at
+// the app, returns
+func oktaSamlForm(ctx context.Context, client *http.Client, formUrl string) (string, error) {
+	content, err := oktaGet(ctx, client, formUrl)
+	if err != nil {
+		return "", err
+	}
+
+	input := samlResponseInputRegex.Find(content)
+	if input == nil {
+		return "", errors.New("the okta app didn't return a SAML response. please check okta_app_url")
+	}
+
+	value := inputValueRegex.FindSubmatch(input)
+	if value == nil {
+		return "", errors.New("the okta app returned an empty SAML response")
+	}
+
+	return html.UnescapeString(string(value[1])), nil
+}
+
+func oktaGet(ctx context.Context, client *http.Client, pageUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("okta returned %s for %s", res.Status, pageUrl)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<22))
+}
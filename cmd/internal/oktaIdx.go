@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const oktaIdxContentType = "application/ion+json; okta-version=1.0.0"
+
+const (
+	oktaIdxMethodPassword = "password"
+	oktaIdxMethodPush     = "push"
+	oktaIdxMethodTotp     = "totp"
+	oktaIdxMethodOtp      = "otp"
+)
+
+var oktaStateTokenRegex = regexp.MustCompile(`stateToken\s*[:=]\s*["']([^"']+)["']`)
+var javascriptHexEscapeRegex = regexp.MustCompile(`\\x([0-9a-fA-F]{2})`)
+
+// oktaIdxLogin logs in through the IDX api of the Okta Identity Engine, by
+// taking the remediations Okta offers until the login succeeds
+type oktaIdxLogin struct {
+	client   *http.Client
+	username string
+	password string
+	// prompt and choose ask the user for a code and to pick an authenticator
+	prompt func(label string) (string, error)
+	choose func(label string, items []string) (int, error)
+
+	passwordSent bool
+	pushShown    bool
+	answerShown  bool
+}
+
+func newOktaIdxLogin(client *http.Client, username string, password string) *oktaIdxLogin {
+	prompter := Prompter{}
+	return &oktaIdxLogin{
+		client:   client,
+		username: username,
+		password: password,
+		prompt: func(label string) (string, error) {
+			return prompter.Prompt(label, "")
+		},
+		choose: func(label string, items []string) (int, error) {
+			index, _, err := prompter.Select(label, items, nil)
+			return index, err
+		},
+	}
+}
+
+// oktaIdxChoice is an authenticator, with one of its methods, the login can
+// continue with
+type oktaIdxChoice struct {
+	label  string
+	method string
+	values map[string]string
+}
+
+// run starts the login from the sign in page the app url shows without a
+// session, and returns the SAML response of the app
+func (l *oktaIdxLogin) run(ctx context.Context, baseUrl string, appUrl string) (string, error) {
+	stateToken, err := l.stateToken(ctx, appUrl)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := l.post(ctx, baseUrl+"/idp/idx/introspect", map[string]interface{}{
+		"stateToken": stateToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if res.Success != nil && res.Success.Href != "" {
+			return oktaSamlForm(ctx, l.client, res.Success.Href)
+		}
+		if message := res.errorMessage(); message != "" {
+			return "", fmt.Errorf("okta rejected the login: %s", message)
+		}
+
+		res, err = l.step(ctx, res)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// step takes the next remediation of the login. Polling a push and entering
+// a code come before choosing another authenticator, which Okta offers along
+func (l *oktaIdxLogin) step(ctx context.Context, res *oktaIdxResponse) (*oktaIdxResponse, error) {
+	if remediation := res.remediation("identify"); remediation != nil {
+		return l.identify(ctx, res, remediation)
+	}
+	if remediation := res.remediation("challenge-poll"); remediation != nil {
+		return l.poll(ctx, res, remediation)
+	}
+	if remediation := res.remediation("challenge-authenticator"); remediation != nil {
+		return l.challenge(ctx, res, remediation)
+	}
+	if remediation := res.remediation("select-authenticator-authenticate"); remediation != nil {
+		return l.selectAuthenticator(ctx, res, remediation)
+	}
+
+	var names []string
+	for _, remediation := range res.Remediation.Value {
+		names = append(names, remediation.Name)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("okta ended the login without signing in")
+	}
+	return nil, fmt.Errorf("okta asked for %s, which awsure doesn't support", strings.Join(names, ", "))
+}
+
+func (l *oktaIdxLogin) identify(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation) (*oktaIdxResponse, error) {
+	body := map[string]interface{}{
+		"identifier": l.username,
+	}
+	// Orgs that ask for the password on the first page take it with the
+	// username
+	if remediation.field("credentials") != nil {
+		body["credentials"] = map[string]string{"passcode": l.password}
+		l.passwordSent = true
+	}
+
+	next, err := l.submit(ctx, res, remediation, body)
+	if err != nil {
+		return nil, err
+	}
+	if message := next.errorMessage(); message != "" {
+		return nil, fmt.Errorf("%w: %s", invalidCredentialsError, message)
+	}
+	return next, nil
+}
+
+func (l *oktaIdxLogin) challenge(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation) (*oktaIdxResponse, error) {
+	authenticator := res.CurrentAuthenticator.Value
+	if authenticator.Type == oktaIdxMethodPassword {
+		l.passwordSent = true
+		next, err := l.submit(ctx, res, remediation, map[string]interface{}{
+			"credentials": map[string]string{"passcode": l.password},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if message := next.errorMessage(); message != "" {
+			return nil, fmt.Errorf("%w: %s", invalidCredentialsError, message)
+		}
+		return next, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		passCode, err := l.prompt(oktaIdxAuthenticatorName(authenticator) + " Code")
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := l.submit(ctx, res, remediation, map[string]interface{}{
+			"credentials": map[string]string{"passcode": strings.TrimSpace(passCode)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		message := next.errorMessage()
+		if message == "" {
+			return next, nil
+		}
+		retry := next.remediation("challenge-authenticator")
+		if attempt == oktaPasscodeAttempts || retry == nil {
+			return nil, fmt.Errorf("%w: %s", invalidPasscodeError, message)
+		}
+
+		fmt.Printf("%s. Please try again\n", strings.TrimSuffix(message, "."))
+		res, remediation = next, retry
+	}
+}
+
+func (l *oktaIdxLogin) selectAuthenticator(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation) (*oktaIdxResponse, error) {
+	var choices []oktaIdxChoice
+	for _, choice := range oktaIdxChoices(remediation) {
+		if choice.method == oktaIdxMethodPassword {
+			// The password is known, so it's sent without asking
+			if !l.passwordSent {
+				return l.submitChoice(ctx, res, remediation, choice)
+			}
+			continue
+		}
+		choices = append(choices, choice)
+	}
+
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("none of your okta authenticators are supported. supported authenticators are okta verify push and codes of okta verify and google authenticator")
+	}
+
+	choice := choices[0]
+	if len(choices) > 1 {
+		var items []string
+		for _, c := range choices {
+			items = append(items, c.label)
+		}
+
+		index, err := l.choose("Select your MFA factor", items)
+		if err != nil {
+			return nil, err
+		}
+		choice = choices[index]
+	}
+
+	return l.submitChoice(ctx, res, remediation, choice)
+}
+
+func (l *oktaIdxLogin) submitChoice(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation, choice oktaIdxChoice) (*oktaIdxResponse, error) {
+	next, err := l.submit(ctx, res, remediation, map[string]interface{}{
+		"authenticator": choice.values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if message := next.errorMessage(); message != "" {
+		return nil, fmt.Errorf("okta couldn't use %s: %s", choice.label, message)
+	}
+	return next, nil
+}
+
+// poll waits for the Okta Verify push to be answered
+func (l *oktaIdxLogin) poll(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation) (*oktaIdxResponse, error) {
+	if !l.pushShown {
+		fmt.Println("A push notification was sent to Okta Verify")
+		l.pushShown = true
+	}
+	if correctAnswer := res.CurrentAuthenticator.Value.ContextualData.CorrectAnswer; correctAnswer != 0 && !l.answerShown {
+		fmt.Printf("Select %d in Okta Verify\n", correctAnswer)
+		l.answerShown = true
+	}
+
+	wait := time.Duration(remediation.Refresh) * time.Millisecond
+	if wait <= 0 {
+		wait = 2 * time.Second
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(wait):
+	}
+
+	next, err := l.submit(ctx, res, remediation, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if message := next.errorMessage(); message != "" {
+		return nil, fmt.Errorf("the okta verify push failed: %s", message)
+	}
+	return next, nil
+}
+
+// stateToken reads the state token of the login from the sign in page. The
+// page escapes it for javascript
+func (l *oktaIdxLogin) stateToken(ctx context.Context, appUrl string) (string, error) {
+	content, err := oktaGet(ctx, l.client, appUrl)
+	if err != nil {
+		return "", err
+	}
+
+	match := oktaStateTokenRegex.FindSubmatch(content)
+	if match == nil {
+		return "", errors.New("the okta sign in page has no state token to log in with. please check okta_app_url")
+	}
+
+	return javascriptHexEscapeRegex.ReplaceAllStringFunc(string(match[1]), func(escape string) string {
+		value, _ := strconv.ParseUint(escape[2:], 16, 8)
+		return string(rune(value))
+	}), nil
+}
+
+func (l *oktaIdxLogin) submit(ctx context.Context, res *oktaIdxResponse, remediation *oktaIdxRemediation, body map[string]interface{}) (*oktaIdxResponse, error) {
+	body["stateHandle"] = res.StateHandle
+	return l.post(ctx, remediation.Href, body)
+}
+
+// post sends a step of the login. Okta answers a rejected step with an error
+// status and the remediations to try again, which are returned with their
+// messages
+func (l *oktaIdxLogin) post(ctx context.Context, endpoint string, body map[string]interface{}) (*oktaIdxResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", oktaIdxContentType)
+	req.Header.Set("Content-Type", oktaIdxContentType)
+
+	httpRes, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = httpRes.Body.Close()
+	}()
+
+	content, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &oktaIdxResponse{}
+	err = json.Unmarshal(content, res)
+	if httpRes.StatusCode >= 400 && (err != nil || res.errorMessage() == "") {
+		return nil, fmt.Errorf("okta returned %s", httpRes.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the okta response: %v", err)
+	}
+	return res, nil
+}
+
+func (r *oktaIdxResponse) remediation(name string) *oktaIdxRemediation {
+	for i := range r.Remediation.Value {
+		if r.Remediation.Value[i].Name == name {
+			return &r.Remediation.Value[i]
+		}
+	}
+	return nil
+}
+
+// errorMessage joins the error messages of the response, or returns an empty
+// string when there are none
+func (r *oktaIdxResponse) errorMessage() string {
+	var messages []string
+	for _, message := range r.Messages.Value {
+		if message.Class == "ERROR" {
+			messages = append(messages, message.Message)
+		}
+	}
+	return strings.Join(messages, " ")
+}
+
+func (r *oktaIdxRemediation) field(name string) *oktaIdxField {
+	for i := range r.Value {
+		if r.Value[i].Name == name {
+			return &r.Value[i]
+		}
+	}
+	return nil
+}
+
+// oktaIdxChoices returns an entry for each supported method of each
+// authenticator the remediation offers, with the values that select it
+func oktaIdxChoices(remediation *oktaIdxRemediation) []oktaIdxChoice {
+	field := remediation.field("authenticator")
+	if field == nil {
+		return nil
+	}
+
+	var choices []oktaIdxChoice
+	for _, option := range field.Options {
+		authenticator := oktaIdxField{}
+		if json.Unmarshal(option.Value, &authenticator) != nil {
+			continue
+		}
+
+		values := make(map[string]string)
+		var methods []oktaIdxOption
+		for _, formField := range authenticator.Form.Value {
+			var value string
+			if json.Unmarshal(formField.Value, &value) == nil {
+				values[formField.Name] = value
+			}
+			if formField.Name == "methodType" {
+				methods = formField.Options
+			}
+		}
+
+		labels := make(map[string]string)
+		if method := values["methodType"]; method != "" {
+			labels[method] = option.Label
+		}
+		for _, method := range methods {
+			var value string
+			if json.Unmarshal(method.Value, &value) == nil {
+				labels[value] = fmt.Sprintf("%s (%s)", option.Label, method.Label)
+			}
+		}
+
+		for _, method := range []string{oktaIdxMethodPassword, oktaIdxMethodPush, oktaIdxMethodTotp, oktaIdxMethodOtp} {
+			label, ok := labels[method]
+			if !ok {
+				continue
+			}
+
+			choiceValues := map[string]string{"methodType": method}
+			for name, value := range values {
+				if name != "methodType" {
+					choiceValues[name] = value
+				}
+			}
+			choices = append(choices, oktaIdxChoice{label: label, method: method, values: choiceValues})
+		}
+	}
+
+	return choices
+}
+
+func oktaIdxAuthenticatorName(authenticator oktaIdxAuthenticator) string {
+	switch {
+	case authenticator.Key == "google_otp":
+		return "Google Authenticator"
+	case authenticator.DisplayName != "":
+		return authenticator.DisplayName
+	default:
+		return "Okta Verify"
+	}
+}
@@ -0,0 +1,360 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const (
+	testOktaPassword = "hunter2"
+	testOktaCode     = "123456"
+	testOktaSaml     = "PHNhbWxwOlJlc3BvbnNlLz4="
+)
+
+// fakeOktaIdx is an Okta org on the Identity Engine that asks for the
+// password, then for an Okta Verify code or push
+type fakeOktaIdx struct {
+	server *httptest.Server
+	// polls is how many times the push is polled before it's approved
+	polls int
+	// passwordChecked is set once the password was answered, after which
+	// codes are
+	passwordChecked bool
+}
+
+func newFakeOktaIdx(t *testing.T) *fakeOktaIdx {
+	fake := &fakeOktaIdx{}
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("%s: invalid body: %v", r.URL.Path, err)
+			}
+			if r.URL.Path != "/idp/idx/introspect" && body["stateHandle"] != "handle" {
+				t.Errorf("%s: stateHandle = %v", r.URL.Path, body["stateHandle"])
+			}
+		}
+
+		switch r.URL.Path {
+		case "/home/amazon_aws/0oa/272":
+			_, _ = fmt.Fprint(w, `<html><script>var stateToken = '00st\x2Dtoken';</script></html>`)
+		case "/idp/idx/introspect":
+			if body["stateToken"] != "00st-token" {
+				t.Errorf("stateToken = %v", body["stateToken"])
+			}
+			fake.respond(w, http.StatusOK, fake.remediations("identify"), "", nil)
+		case "/idp/idx/identify":
+			if body["identifier"] != "user@example.com" {
+				t.Errorf("identifier = %v", body["identifier"])
+			}
+			fake.respond(w, http.StatusOK, fake.remediations("challenge-authenticator", "select-authenticator-authenticate"), "password", nil)
+		case "/idp/idx/challenge":
+			authenticator, _ := body["authenticator"].(map[string]interface{})
+			if authenticator["id"] != "aut-verify" {
+				t.Errorf("authenticator = %v", authenticator)
+			}
+			if authenticator["methodType"] == oktaIdxMethodPush {
+				fake.respond(w, http.StatusOK, fake.remediations("challenge-poll", "select-authenticator-authenticate"), "app", nil)
+				return
+			}
+			fake.respond(w, http.StatusOK, fake.remediations("challenge-authenticator", "select-authenticator-authenticate"), "app", nil)
+		case "/idp/idx/challenge/answer":
+			if !fake.passwordChecked {
+				if passcode(body) != testOktaPassword {
+					fake.respond(w, http.StatusUnauthorized, fake.remediations("challenge-authenticator"), "password", []string{"Password is incorrect"})
+					return
+				}
+				fake.passwordChecked = true
+				fake.respond(w, http.StatusOK, fake.remediations("select-authenticator-authenticate"), "", nil)
+				return
+			}
+			if passcode(body) != testOktaCode {
+				fake.respond(w, http.StatusBadRequest, fake.remediations("challenge-authenticator", "select-authenticator-authenticate"), "app", []string{"Invalid code. Try again."})
+				return
+			}
+			fake.succeed(w)
+		case "/idp/idx/authenticators/poll":
+			if fake.polls > 0 {
+				fake.polls--
+				fake.respond(w, http.StatusOK, fake.remediations("challenge-poll", "select-authenticator-authenticate"), "app", nil)
+				return
+			}
+			fake.succeed(w)
+		case "/login/token/redirect":
+			_, _ = fmt.Fprintf(w, `<form method="POST" action="https://signin.aws.amazon.com/saml"><input type="hidden" name="SAMLResponse" value="%s"/></form>`, testOktaSaml)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func passcode(body map[string]interface{}) string {
+	credentials, _ := body["credentials"].(map[string]interface{})
+	value, _ := credentials["passcode"].(string)
+	return value
+}
+
+func (f *fakeOktaIdx) remediations(names ...string) []interface{} {
+	url := f.server.URL
+	all := map[string]interface{}{
+		"identify": map[string]interface{}{
+			"name":  "identify",
+			"href":  url + "/idp/idx/identify",
+			"value": []interface{}{map[string]interface{}{"name": "identifier"}, map[string]interface{}{"name": "stateHandle"}},
+		},
+		"challenge-authenticator": map[string]interface{}{
+			"name":  "challenge-authenticator",
+			"href":  url + "/idp/idx/challenge/answer",
+			"value": []interface{}{map[string]interface{}{"name": "credentials"}},
+		},
+		"challenge-poll": map[string]interface{}{
+			"name":    "challenge-poll",
+			"href":    url + "/idp/idx/authenticators/poll",
+			"refresh": 1,
+		},
+		"select-authenticator-authenticate": map[string]interface{}{
+			"name": "select-authenticator-authenticate",
+			"href": url + "/idp/idx/challenge",
+			"value": []interface{}{map[string]interface{}{
+				"name": "authenticator",
+				"options": []interface{}{
+					map[string]interface{}{
+						"label": "Password",
+						"value": map[string]interface{}{"form": map[string]interface{}{"value": []interface{}{
+							map[string]interface{}{"name": "id", "value": "aut-password"},
+							map[string]interface{}{"name": "methodType", "value": "password"},
+						}}},
+					},
+					map[string]interface{}{
+						"label": "Okta Verify",
+						"value": map[string]interface{}{"form": map[string]interface{}{"value": []interface{}{
+							map[string]interface{}{"name": "id", "value": "aut-verify"},
+							map[string]interface{}{"name": "methodType", "options": []interface{}{
+								map[string]interface{}{"label": "Enter a code", "value": "totp"},
+								map[string]interface{}{"label": "Get a push notification", "value": "push"},
+							}},
+						}}},
+					},
+					map[string]interface{}{
+						"label": "Security Key",
+						"value": map[string]interface{}{"form": map[string]interface{}{"value": []interface{}{
+							map[string]interface{}{"name": "id", "value": "aut-webauthn"},
+							map[string]interface{}{"name": "methodType", "value": "webauthn"},
+						}}},
+					},
+				},
+			}},
+		},
+	}
+
+	var remediations []interface{}
+	for _, name := range names {
+		remediations = append(remediations, all[name])
+	}
+	return remediations
+}
+
+func (f *fakeOktaIdx) respond(w http.ResponseWriter, status int, remediations []interface{}, authenticator string, messages []string) {
+	body := map[string]interface{}{
+		"stateHandle": "handle",
+		"remediation": map[string]interface{}{"value": remediations},
+	}
+	if authenticator != "" {
+		body["currentAuthenticator"] = map[string]interface{}{"value": map[string]interface{}{
+			"type":           authenticator,
+			"key":            "okta_verify",
+			"displayName":    "Okta Verify",
+			"contextualData": map[string]interface{}{"correctAnswer": 42},
+		}}
+	}
+	if len(messages) > 0 {
+		var values []interface{}
+		for _, message := range messages {
+			values = append(values, map[string]interface{}{"message": message, "class": "ERROR"})
+		}
+		body["messages"] = map[string]interface{}{"value": values}
+	}
+
+	w.Header().Set("Content-Type", oktaIdxContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeOktaIdx) succeed(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", oktaIdxContentType)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"stateHandle": "handle",
+		"success":     map[string]interface{}{"href": f.server.URL + "/login/token/redirect?stateToken=done"},
+	})
+}
+
+func TestOktaIdxLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		method   string
+		codes    []string
+		polls    int
+		wantErr  error
+		// wantPrompts is how many codes the user is asked for
+		wantPrompts int
+	}{
+		{
+			name:        "code",
+			password:    testOktaPassword,
+			method:      "Okta Verify (Enter a code)",
+			codes:       []string{testOktaCode},
+			wantPrompts: 1,
+		},
+		{
+			name:        "wrong code then the right one",
+			password:    testOktaPassword,
+			method:      "Okta Verify (Enter a code)",
+			codes:       []string{"000000", " " + testOktaCode + " "},
+			wantPrompts: 2,
+		},
+		{
+			name:        "every code wrong",
+			password:    testOktaPassword,
+			method:      "Okta Verify (Enter a code)",
+			codes:       []string{"000000", "111111", "222222", testOktaCode},
+			wantErr:     invalidPasscodeError,
+			wantPrompts: oktaPasscodeAttempts,
+		},
+		{
+			name:     "push",
+			password: testOktaPassword,
+			method:   "Okta Verify (Get a push notification)",
+			polls:    2,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong",
+			wantErr:  invalidCredentialsError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeOktaIdx(t)
+			fake.polls = tt.polls
+
+			prompts := 0
+			login := newOktaIdxLogin(fake.server.Client(), "user@example.com", tt.password)
+			login.prompt = func(label string) (string, error) {
+				if label != "Okta Verify Code" {
+					t.Errorf("prompt label = %q", label)
+				}
+				code := tt.codes[prompts]
+				prompts++
+				return code, nil
+			}
+			login.choose = func(label string, items []string) (int, error) {
+				want := []string{"Okta Verify (Get a push notification)", "Okta Verify (Enter a code)"}
+				if !reflect.DeepEqual(items, want) {
+					t.Errorf("choices = %v, want %v", items, want)
+				}
+				for i, item := range items {
+					if item == tt.method {
+						return i, nil
+					}
+				}
+				return 0, fmt.Errorf("no choice %s", tt.method)
+			}
+
+			saml, err := login.run(context.Background(), fake.server.URL, fake.server.URL+"/home/amazon_aws/0oa/272")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if saml != testOktaSaml {
+				t.Errorf("saml = %q, want %q", saml, testOktaSaml)
+			}
+
+			if prompts != tt.wantPrompts {
+				t.Errorf("prompted for %d codes, want %d", prompts, tt.wantPrompts)
+			}
+		})
+	}
+}
+
+func TestOktaIdxChoices(t *testing.T) {
+	remediation := &oktaIdxRemediation{}
+	content, err := json.Marshal((&fakeOktaIdx{server: &httptest.Server{URL: "https://example.okta.com"}}).remediations("select-authenticator-authenticate")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(content, remediation); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []oktaIdxChoice{
+		{label: "Password", method: "password", values: map[string]string{"id": "aut-password", "methodType": "password"}},
+		{label: "Okta Verify (Get a push notification)", method: "push", values: map[string]string{"id": "aut-verify", "methodType": "push"}},
+		{label: "Okta Verify (Enter a code)", method: "totp", values: map[string]string{"id": "aut-verify", "methodType": "totp"}},
+	}
+	if got := oktaIdxChoices(remediation); !reflect.DeepEqual(got, want) {
+		t.Errorf("oktaIdxChoices() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOktaPostErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:    "invalid credentials",
+			status:  http.StatusUnauthorized,
+			body:    `{"errorCode":"E0000004","errorSummary":"Authentication failed"}`,
+			wantErr: invalidCredentialsError,
+		},
+		{
+			name:    "invalid passcode",
+			status:  http.StatusForbidden,
+			body:    `{"errorCode":"E0000068","errorSummary":"Invalid Passcode/Answer"}`,
+			wantErr: invalidPasscodeError,
+		},
+		{
+			name:    "html error page",
+			status:  http.StatusBadGateway,
+			body:    `<html>Bad Gateway</html>`,
+			wantMsg: "okta returned 502 Bad Gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			_, err := oktaPost(context.Background(), server.Client(), server.URL, map[string]string{})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
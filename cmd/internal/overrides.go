@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const environmentPrefix = "AWSURE_"
+
+// builtinDefaults are the values profiles have when nothing else sets them
+var builtinDefaults = configuration{
+	Idp:                  idpAzure,
+	DefaultDurationHours: 1,
+}
+
+// configLayer is a set of values applied over the layers before it. source
+// says where they come from
+type configLayer struct {
+	source string
+	config *configuration
+}
+
+// configOverride is a single value given outside the config file
+type configOverride struct {
+	key    string
+	value  string
+	source string
+	// appends is set for lists that are added to the configured ones
+	appends bool
+}
+
+// effectiveConfig returns the config a profile logs in with: the built-in
+// defaults, then the config file, then AWSURE_* environment variables and then
+// the command line flags. The profile itself is left as it is, so overrides
+// are never saved
+func effectiveConfig(config *configuration, options types.Configuration) (*configuration, error) {
+	effective, _, err := layerConfig([]configLayer{{source: "config file", config: config}}, options)
+	return effective, err
+}
+
+// layerConfig applies the built-in defaults, the given layers of the config
+// file and the overrides, and returns where each value came from by its key
+func layerConfig(fileLayers []configLayer, options types.Configuration) (*configuration, map[string]string, error) {
+	layered := &configuration{}
+	sources := make(map[string]string)
+
+	layers := append([]configLayer{{source: "default", config: &builtinDefaults}}, fileLayers...)
+	for _, layer := range layers {
+		layered.Merge(layer.config)
+		recordSources(layer, layered, sources)
+	}
+
+	overrides, err := configOverrides(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, override := range overrides {
+		field, _ := configurationField(layered, override.key)
+
+		value := &configuration{}
+		overrideField, _ := configurationField(value, override.key)
+		err = valueNode(field.Kind(), override.value).Decode(overrideField.Addr().Interface())
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %s from %s: %v", override.key, override.source, err)
+		}
+
+		if override.appends {
+			field.Set(reflect.AppendSlice(field, overrideField))
+		} else {
+			field.Set(overrideField)
+		}
+		sources[override.key] = override.source
+	}
+
+	return layered, sources, nil
+}
+
+// configOverrides returns the AWSURE_* environment variables and then the flags
+// that set values of profiles. The values are checked like the config file
+func configOverrides(options types.Configuration) ([]configOverride, error) {
+	var overrides []configOverride
+
+	for _, key := range overridableConfigKeys() {
+		name := environmentVariable(key)
+		if value, ok := os.LookupEnv(name); ok {
+			overrides = append(overrides, configOverride{key: key, value: value, source: "environment " + name})
+		}
+	}
+
+	flags := []struct {
+		name  string
+		key   string
+		value string
+		set   bool
+	}{
+		{"auth-mode", "auth_mode", options.AuthMode, options.AuthMode != ""},
+		{"browser-url", "browser_url", options.BrowserUrl, options.BrowserUrl != ""},
+		{"browser-path", "browser_path", options.BrowserPath, options.BrowserPath != ""},
+		{"no-sandbox", "browser_no_sandbox", strconv.FormatBool(options.NoSandbox), options.NoSandbox},
+		{"proxy", "proxy", options.Proxy, options.Proxy != ""},
+		{"ca-bundle", "ca_bundle", options.CaBundle, options.CaBundle != ""},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			overrides = append(overrides, configOverride{key: flag.key, value: flag.value, source: "flag --" + flag.name})
+		}
+	}
+	if len(options.BrowserArgs) > 0 {
+		overrides = append(overrides, configOverride{
+			key:     "browser_args",
+			value:   strings.Join(options.BrowserArgs, ","),
+			source:  "flag --browser-arg",
+			appends: true,
+		})
+	}
+	for _, flag := range options.ProfileFlags {
+		overrides = append(overrides, configOverride{key: flag.Key, value: flag.Value, source: "flag --" + flag.Name})
+	}
+
+	var problems []string
+	for _, override := range overrides {
+		validator, ok := configValueValidators[override.key]
+		if !ok {
+			continue
+		}
+
+		field, _ := configurationField(&configuration{}, override.key)
+		severity, message := validator(valueNode(field.Kind(), override.value))
+		switch severity {
+		case problemError:
+			problems = append(problems, fmt.Sprintf("%s from %s: %s", override.key, override.source, message))
+		case problemWarning:
+			warn("%s from %s: %s", override.key, override.source, message)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid values:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return overrides, nil
+}
+
+// overridableConfigKeys are the keys that can be set outside the config file.
+// The blocks a profile inherits from can only be named in the file
+func overridableConfigKeys() []string {
+	var keys []string
+	for _, key := range yamlKeys(reflect.TypeOf(configuration{})) {
+		if key != "identity" && key != "defaults" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func environmentVariable(key string) string {
+	return environmentPrefix + strings.ToUpper(key)
+}
+
+// recordSources marks the values the layer set, which are the ones it has and
+// the layered config took
+func recordSources(layer configLayer, layered *configuration, sources map[string]string) {
+	layerValue := reflect.ValueOf(layer.config).Elem()
+	layeredValue := reflect.ValueOf(layered).Elem()
+	t := layeredValue.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+
+		key := yamlKey(t.Field(i))
+		field := layerValue.Field(i)
+		if (isEmptyValue(field) && !layer.config.explicit[key]) || !reflect.DeepEqual(field.Interface(), layeredValue.Field(i).Interface()) {
+			continue
+		}
+		sources[key] = layer.source
+	}
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"reflect"
+	"testing"
+)
+
+func TestLayerConfig(t *testing.T) {
+	identity := &configuration{Idp: idpAzure, AzureTenantId: "tenant", RememberMe: true}
+	profile := &configuration{Region: "eu-west-1", BrowserArgs: []string{"--incognito"}}
+	profile.markExplicit("remember_me")
+	layers := []configLayer{
+		{source: "identity work", config: identity},
+		{source: "profile", config: profile},
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		options     types.Configuration
+		want        func(config *configuration)
+		wantSources map[string]string
+		wantErr     bool
+	}{
+		{
+			name: "config file",
+			want: func(config *configuration) {},
+			wantSources: map[string]string{
+				"idp":                    "identity work",
+				"azure_tenant_id":        "identity work",
+				"remember_me":            "profile",
+				"region":                 "profile",
+				"browser_args":           "profile",
+				"default_duration_hours": "default",
+			},
+		},
+		{
+			name: "environment variables override the config file",
+			env:  map[string]string{"AWSURE_REGION": "us-east-1", "AWSURE_REMEMBER_ME": "true"},
+			want: func(config *configuration) {
+				config.Region = "us-east-1"
+				config.RememberMe = true
+			},
+			wantSources: map[string]string{
+				"region":      "environment AWSURE_REGION",
+				"remember_me": "environment AWSURE_REMEMBER_ME",
+			},
+		},
+		{
+			name: "flags override environment variables",
+			env:  map[string]string{"AWSURE_REGION": "us-east-1", "AWSURE_PROXY": "http://env.example.com:8080"},
+			options: types.Configuration{
+				Proxy:        "http://flag.example.com:8080",
+				ProfileFlags: []types.ProfileFlag{{Name: "region", Key: "region", Value: "us-west-2"}},
+			},
+			want: func(config *configuration) {
+				config.Region = "us-west-2"
+				config.Proxy = "http://flag.example.com:8080"
+			},
+			wantSources: map[string]string{
+				"region": "flag --region",
+				"proxy":  "flag --proxy",
+			},
+		},
+		{
+			name:    "browser args are added to the configured ones",
+			options: types.Configuration{BrowserArgs: []string{"--headless", "--lang=en"}},
+			want: func(config *configuration) {
+				config.BrowserArgs = []string{"--incognito", "--headless", "--lang=en"}
+			},
+			wantSources: map[string]string{"browser_args": "flag --browser-arg"},
+		},
+		{
+			name:    "invalid values",
+			env:     map[string]string{"AWSURE_DEFAULT_DURATION_HOURS": "24"},
+			options: types.Configuration{AuthMode: "password"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			got, sources, err := layerConfig(layers, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("layerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := &configuration{Idp: idpAzure, AzureTenantId: "tenant", DefaultDurationHours: 1,
+				Region: "eu-west-1", BrowserArgs: []string{"--incognito"}}
+			tt.want(want)
+			got.explicit = nil
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("layerConfig() = %+v, want %+v", got, want)
+			}
+
+			for key, source := range tt.wantSources {
+				if sources[key] != source {
+					t.Errorf("source of %s = %q, want %q", key, sources[key], source)
+				}
+			}
+		})
+	}
+
+	if !reflect.DeepEqual(profile.BrowserArgs, []string{"--incognito"}) {
+		t.Errorf("layerConfig() changed the browser args of the profile to %v", profile.BrowserArgs)
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	t.Setenv("AWSURE_REGION", "eu-west-1")
+	t.Setenv("AWSURE_IDENTITY", "work")
+
+	overrides, err := configOverrides(types.Configuration{
+		NoSandbox:    true,
+		ProfileFlags: []types.ProfileFlag{{Name: "duration", Key: "default_duration_hours", Value: "2"}},
+	})
+	if err != nil {
+		t.Fatalf("configOverrides() error = %v", err)
+	}
+
+	want := []configOverride{
+		{key: "region", value: "eu-west-1", source: "environment AWSURE_REGION"},
+		{key: "browser_no_sandbox", value: "true", source: "flag --no-sandbox"},
+		{key: "default_duration_hours", value: "2", source: "flag --duration"},
+	}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("configOverrides() = %+v, want %+v", overrides, want)
+	}
+}
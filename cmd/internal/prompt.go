@@ -1,9 +1,11 @@
 package internal
 
 import (
+	"fmt"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/manifoldco/promptui"
 	"strings"
+	"sync/atomic"
 )
 
 type Prompt interface {
@@ -14,6 +16,24 @@ type Prompt interface {
 type Prompter struct {
 }
 
+// activePrompts counts the prompts reading the terminal. They don't watch the
+// context, so a signal can't end them by cancelling it
+var activePrompts atomic.Int32
+
+// IsPrompting reports if a prompt is waiting for input
+func IsPrompting() bool {
+	return activePrompts.Load() > 0
+}
+
+// startPrompt marks a prompt as waiting for input until the returned function
+// is called
+func startPrompt() func() {
+	activePrompts.Add(1)
+	return func() {
+		activePrompts.Add(-1)
+	}
+}
+
 func (receiver *Prompter) Select(label string, toSelect []string, searcher func(input string, index int) bool) (int, string, error) {
 	prompt := promptui.Select{
 		Label:             label,
@@ -22,6 +42,7 @@ func (receiver *Prompter) Select(label string, toSelect []string, searcher func(
 		Searcher:          searcher,
 		StartInSearchMode: searcher != nil,
 	}
+	defer startPrompt()()
 	return prompt.Run()
 }
 
@@ -31,6 +52,7 @@ func (receiver *Prompter) Prompt(label string, defaultValue string) (string, err
 		Default:   defaultValue,
 		AllowEdit: false,
 	}
+	defer startPrompt()()
 	return prompt.Run()
 }
 
@@ -40,6 +62,7 @@ func (receiver *Prompter) SensitivePrompt(label string) (string, error) {
 		Mask:      '*',
 		AllowEdit: false,
 	}
+	defer startPrompt()()
 	return prompt.Run()
 }
 
@@ -60,3 +83,102 @@ func fuzzySearchWithPrefixAnchor(itemsToSelect []string, linePrefix string) func
 		return false
 	}
 }
+
+// MultiSelect lets the user toggle items until they choose done, and returns
+// the indexes of the selected items in order
+func (receiver *Prompter) MultiSelect(label string, toSelect []string, selected []bool) ([]int, error) {
+	if len(selected) != len(toSelect) {
+		selected = make([]bool, len(toSelect))
+	}
+
+	const doneIndex = 0
+	const toggleAllIndex = 1
+	cursor := 0
+
+	for {
+		count := 0
+		for _, s := range selected {
+			if s {
+				count++
+			}
+		}
+
+		items := []string{fmt.Sprintf("Done (%d selected)", count)}
+		if count == len(toSelect) {
+			items = append(items, "Select none")
+		} else {
+			items = append(items, "Select all")
+		}
+		for i, item := range toSelect {
+			mark := "[ ]"
+			if selected[i] {
+				mark = "[x]"
+			}
+			items = append(items, mark+" "+item)
+		}
+
+		prompt := promptui.Select{
+			Label: label + " - Hint: press enter to toggle, / to search",
+			Items: items,
+			Size:  20,
+			Searcher: func(input string, index int) bool {
+				return fuzzy.MatchFold(input, items[index])
+			},
+		}
+
+		done := startPrompt()
+		index, _, err := prompt.RunCursorAt(cursor, cursor-cursor%20)
+		done()
+		if err != nil {
+			return nil, err
+		}
+		cursor = index
+
+		switch index {
+		case doneIndex:
+			var indexes []int
+			for i, s := range selected {
+				if s {
+					indexes = append(indexes, i)
+				}
+			}
+			return indexes, nil
+		case toggleAllIndex:
+			all := count != len(toSelect)
+			for i := range selected {
+				selected[i] = all
+			}
+		default:
+			selected[index-2] = !selected[index-2]
+		}
+	}
+}
+
+func (receiver *Prompter) ValidatedPrompt(label string, defaultValue string, validate func(input string) error) (string, error) {
+	prompt := promptui.Prompt{
+		Label:     label,
+		Default:   defaultValue,
+		AllowEdit: false,
+		Validate:  validate,
+	}
+	defer startPrompt()()
+	return prompt.Run()
+}
+
+// SelectAt is Select with the cursor starting at an item
+func (receiver *Prompter) SelectAt(label string, toSelect []string, cursor int) (int, string, error) {
+	if cursor < 0 || cursor >= len(toSelect) {
+		cursor = 0
+	}
+
+	prompt := promptui.Select{
+		Label: label,
+		Items: toSelect,
+		Size:  20,
+		Searcher: func(input string, index int) bool {
+			return fuzzy.MatchFold(input, toSelect[index])
+		},
+	}
+	defer startPrompt()()
+	return prompt.RunCursorAt(cursor, cursor-cursor%20)
+}
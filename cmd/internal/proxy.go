@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// proxyForwarder is a local proxy that forwards every request to an upstream
+// proxy with its credentials. Chromium can't take proxy credentials as a flag,
+// so it's pointed at the forwarder instead. It only runs during the login and
+// only listens on the loopback interface, and where the owner of a connection
+// can be found, it only takes connections of the user running awsure.
+type proxyForwarder struct {
+	listener      net.Listener
+	upstream      string
+	authorization string
+	// tlsConfig is set when the upstream proxy is reached over https
+	tlsConfig *tls.Config
+	wg        sync.WaitGroup
+}
+
+func startProxyForwarder(upstream *url.URL, caBundle string) (*proxyForwarder, error) {
+	var tlsConfig *tls.Config
+	defaultPort := "80"
+	if upstream.Scheme == "https" {
+		tlsConfig = &tls.Config{ServerName: upstream.Hostname()}
+		defaultPort = "443"
+
+		if caBundle != "" {
+			pool, err := caBundlePool(caBundle)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	host := upstream.Host
+	if upstream.Port() == "" {
+		host = net.JoinHostPort(upstream.Hostname(), defaultPort)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	password, _ := upstream.User.Password()
+	credentials := upstream.User.Username() + ":" + password
+
+	forwarder := &proxyForwarder{
+		listener:      listener,
+		upstream:      host,
+		authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)),
+		tlsConfig:     tlsConfig,
+	}
+
+	forwarder.wg.Add(1)
+	go forwarder.serve()
+
+	return forwarder, nil
+}
+
+func (f *proxyForwarder) address() string {
+	return f.listener.Addr().String()
+}
+
+func (f *proxyForwarder) close() {
+	_ = f.listener.Close()
+	f.wg.Wait()
+}
+
+func (f *proxyForwarder) serve() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *proxyForwarder) handle(client net.Conn) {
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// Other users could otherwise use the proxy with the credentials
+	if !ownConnection(client) {
+		return
+	}
+
+	upstream, err := f.dial()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = upstream.Close()
+	}()
+
+	clientReader := bufio.NewReader(client)
+	upstreamReader := bufio.NewReader(upstream)
+
+	for {
+		req, err := http.ReadRequest(clientReader)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Proxy-Authorization", f.authorization)
+
+		err = req.WriteProxy(upstream)
+		if err != nil {
+			return
+		}
+
+		res, err := http.ReadResponse(upstreamReader, req)
+		if err != nil {
+			return
+		}
+
+		err = res.Write(client)
+		if err != nil {
+			return
+		}
+
+		if req.Method == http.MethodConnect {
+			if res.StatusCode == http.StatusOK {
+				tunnel(client, clientReader, upstream, upstreamReader)
+			}
+			return
+		}
+
+		if res.Close || req.Close {
+			return
+		}
+	}
+}
+
+func (f *proxyForwarder) dial() (net.Conn, error) {
+	if f.tlsConfig != nil {
+		return tls.Dial("tcp", f.upstream, f.tlsConfig)
+	}
+	return net.Dial("tcp", f.upstream)
+}
+
+// tunnel copies the data in both directions until one side closes. The
+// connections are closed by the caller, which ends the other direction
+func tunnel(client net.Conn, clientReader io.Reader, upstream net.Conn, upstreamReader io.Reader) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		_, _ = io.Copy(upstream, clientReader)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstreamReader)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
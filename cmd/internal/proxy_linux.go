@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ownConnection reports if the local connection was opened by a process of
+// the user running awsure. The kernel lists the owner of each socket in
+// /proc/net/tcp
+func ownConnection(conn net.Conn) bool {
+	uid, err := connectionUid(conn)
+	return err == nil && uid == os.Getuid()
+}
+
+func connectionUid(conn net.Conn) (int, error) {
+	local, localOk := conn.LocalAddr().(*net.TCPAddr)
+	remote, remoteOk := conn.RemoteAddr().(*net.TCPAddr)
+	if !localOk || !remoteOk || local.IP.To4() == nil || remote.IP.To4() == nil {
+		return 0, fmt.Errorf("the connection from %s isn't a local ipv4 connection", conn.RemoteAddr())
+	}
+
+	content, err := os.ReadFile("/proc/net/tcp")
+	if err != nil {
+		return 0, err
+	}
+
+	// The socket of the other side has the addresses the other way around
+	source := procNetAddress(remote)
+	destination := procNetAddress(local)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 7 && fields[1] == source && fields[2] == destination {
+			return strconv.Atoi(fields[7])
+		}
+	}
+
+	return 0, fmt.Errorf("the connection from %s isn't listed", conn.RemoteAddr())
+}
+
+// procNetAddress formats the address the way /proc/net/tcp lists it: the ip as
+// a number in the byte order of the machine, and the port, both in hex
+func procNetAddress(address *net.TCPAddr) string {
+	return fmt.Sprintf("%08X:%04X", binary.NativeEndian.Uint32(address.IP.To4()), address.Port)
+}
@@ -0,0 +1,357 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var roleArnPattern = regexp.MustCompile(`^arn:(aws[a-z-]*):iam::(\d{12}):role/[\w+=,.@/-]+$`)
+var samlProviderArnPattern = regexp.MustCompile(`^arn:(aws[a-z-]*):iam::(\d{12}):saml-provider/[\w.-]+$`)
+
+const (
+	samlRoleAttribute            = "https://aws.amazon.com/SAML/Attributes/Role"
+	samlSessionDurationAttribute = "https://aws.amazon.com/SAML/Attributes/SessionDuration"
+	samlRoleSessionNameAttribute = "https://aws.amazon.com/SAML/Attributes/RoleSessionName"
+)
+
+// SamlDecode prints the content of a SAML response, given as the base64 value
+// posted to AWS or as XML, in text or json
+func SamlDecode(saml string, output string) error {
+	response, err := decodeSamlResponse(normalizeSamlInput(saml))
+	if err != nil {
+		return err
+	}
+
+	decoded, err := response.decoded()
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		content, err := json.MarshalIndent(decoded, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+	case "", "text":
+		printSamlDecoded(decoded)
+	default:
+		return fmt.Errorf("unknown output format %s. supported formats are text and json", output)
+	}
+
+	return nil
+}
+
+// FreshSaml logs in with the identity of the profile and returns the SAML
+// response without assuming any role
+func FreshSaml(ctx context.Context, profile string, options types.Configuration) (string, error) {
+	configs, err := loadConfigs()
+	if err != nil {
+		return "", err
+	}
+
+	config, foundConfig := configs[profile]
+	if !foundConfig {
+		return "", fmt.Errorf("profile %s does not exist", profile)
+	}
+
+	config, err = effectiveConfig(config, options)
+	if err != nil {
+		return "", err
+	}
+
+	return getSaml(ctx, config, options)
+}
+
+// normalizeSamlInput turns what users may paste, like XML or the url encoded
+// form value, into the base64 SAML response
+func normalizeSamlInput(saml string) string {
+	saml = strings.TrimSpace(saml)
+	if strings.HasPrefix(saml, "<") {
+		return base64.StdEncoding.EncodeToString([]byte(saml))
+	}
+
+	saml = strings.TrimPrefix(saml, "SAMLResponse=")
+	if strings.Contains(saml, "%") {
+		unescaped, err := url.QueryUnescape(saml)
+		if err == nil {
+			saml = unescaped
+		}
+	}
+
+	return strings.Join(strings.Fields(saml), "")
+}
+
+func decodeSamlResponse(saml string) (*samlResponse, error) {
+	content, err := base64.StdEncoding.DecodeString(saml)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the SAML response: %v", err)
+	}
+
+	response := &samlResponse{}
+	err = xml.Unmarshal(content, response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the SAML response: %v", err)
+	}
+
+	return response, nil
+}
+
+// roles returns the roles the assertion allows to assume, without duplicates.
+// Values that aren't a pair of a role and a SAML provider ARN of the same
+// account are skipped with a warning, unless none is valid
+func (r *samlResponse) roles() ([]role, error) {
+	if r.EncryptedAssertion != nil && r.Assertion.XMLName.Local == "" {
+		return nil, encryptedAssertionError
+	}
+
+	var roles []role
+	var firstErr error
+	seen := make(map[role]bool)
+
+	for _, val := range r.attributeValues(samlRoleAttribute) {
+		rl, err := parseSamlRole(val)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			warn("skipping %v", err)
+			continue
+		}
+
+		if seen[rl] {
+			continue
+		}
+		seen[rl] = true
+		roles = append(roles, rl)
+	}
+
+	if len(roles) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return roles, nil
+}
+
+// parseSamlRole parses a value of the role attribute, which is a role ARN and a
+// SAML provider ARN separated by a comma, in any order
+func parseSamlRole(value string) (role, error) {
+	value = strings.Join(strings.Fields(value), "")
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return role{}, fmt.Errorf("%w: %q should be a role ARN and a SAML provider ARN separated by a comma", invalidSamlRoleError, value)
+	}
+
+	roleArn, principalArn := parts[0], parts[1]
+	if samlProviderArnPattern.MatchString(roleArn) {
+		roleArn, principalArn = principalArn, roleArn
+	}
+
+	roleMatch := roleArnPattern.FindStringSubmatch(roleArn)
+	if roleMatch == nil {
+		return role{}, fmt.Errorf("%w: %q has no valid role ARN", invalidSamlRoleError, value)
+	}
+
+	principalMatch := samlProviderArnPattern.FindStringSubmatch(principalArn)
+	if principalMatch == nil {
+		return role{}, fmt.Errorf("%w: %q has no valid SAML provider ARN", invalidSamlRoleError, value)
+	}
+
+	if roleMatch[1] != principalMatch[1] {
+		return role{}, fmt.Errorf("%w: the role and the SAML provider of %q are in different partitions", invalidSamlRoleError, value)
+	}
+
+	if roleMatch[2] != principalMatch[2] {
+		return role{}, fmt.Errorf("%w: the role and the SAML provider of %q are in different accounts", invalidSamlRoleError, value)
+	}
+
+	return role{
+		roleArn:      roleArn,
+		principalArn: principalArn,
+	}, nil
+}
+
+// sessionDuration returns the maximum session duration, in seconds, the
+// identity provider allows. It's 0 when the assertion doesn't set it
+func (r *samlResponse) sessionDuration() (int32, error) {
+	value := r.attributeValue(samlSessionDurationAttribute)
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("the SAML response has an invalid session duration %q", value)
+	}
+
+	return int32(duration), nil
+}
+
+// roleSessionName returns the name AWS gives to the sessions of the assertion
+func (r *samlResponse) roleSessionName() string {
+	return r.attributeValue(samlRoleSessionNameAttribute)
+}
+
+// attributeValues returns the text of the values of the named attribute
+func (r *samlResponse) attributeValues(name string) []string {
+	var values []string
+	for _, attr := range r.Assertion.AttributeStatement.Attributes {
+		if attr.Name != name {
+			continue
+		}
+
+		for _, val := range attr.AttributeValues {
+			values = append(values, val.text())
+		}
+	}
+	return values
+}
+
+func (r *samlResponse) attributeValue(name string) string {
+	values := r.attributeValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// text is the value without the whitespace and newlines identity providers
+// put around it
+func (v samlAttributeValue) text() string {
+	return strings.TrimSpace(v.Value)
+}
+
+func (r *samlResponse) decoded() (*samlDecoded, error) {
+	assertion := r.Assertion
+
+	decoded := &samlDecoded{
+		Issuer:          assertion.Issuer,
+		Destination:     r.Destination,
+		Recipient:       assertion.Subject.SubjectConfirmationData.Recipient,
+		Encrypted:       r.EncryptedAssertion != nil,
+		Subject:         strings.TrimSpace(assertion.Subject.NameId.Value),
+		SubjectFormat:   assertion.Subject.NameId.Format,
+		NotBefore:       assertion.Conditions.NotBefore,
+		NotOnOrAfter:    assertion.Conditions.NotOnOrAfter,
+		Audiences:       assertion.Conditions.Audiences,
+		SessionDuration: r.attributeValue(samlSessionDurationAttribute),
+		RoleSessionName: r.attributeValue(samlRoleSessionNameAttribute),
+	}
+	if decoded.Issuer == "" {
+		decoded.Issuer = r.Issuer
+	}
+
+	for _, attr := range assertion.AttributeStatement.Attributes {
+		decodedAttribute := samlDecodedAttribute{Name: attr.Name}
+		for _, val := range attr.AttributeValues {
+			decodedAttribute.Values = append(decodedAttribute.Values, val.text())
+		}
+		decoded.Attributes = append(decoded.Attributes, decodedAttribute)
+	}
+
+	certificate, err := r.certificate()
+	if err != nil {
+		return nil, err
+	}
+	if certificate != nil {
+		sha1Fingerprint := sha1.Sum(certificate.Raw)
+		sha256Fingerprint := sha256.Sum256(certificate.Raw)
+
+		decoded.Certificate = &samlDecodedCertificate{
+			Subject:           certificate.Subject.String(),
+			Issuer:            certificate.Issuer.String(),
+			SerialNumber:      certificate.SerialNumber.String(),
+			NotBefore:         certificate.NotBefore,
+			NotAfter:          certificate.NotAfter,
+			Sha1Fingerprint:   strings.ToUpper(hex.EncodeToString(sha1Fingerprint[:])),
+			Sha256Fingerprint: strings.ToUpper(hex.EncodeToString(sha256Fingerprint[:])),
+		}
+	}
+
+	return decoded, nil
+}
+
+// certificate returns the certificate the assertion, or else the response, is
+// signed with. It's nil when neither is signed
+func (r *samlResponse) certificate() (*x509.Certificate, error) {
+	encoded := r.Assertion.Signature.Certificate
+	if encoded == "" {
+		encoded = r.Signature.Certificate
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the signature certificate: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the signature certificate: %v", err)
+	}
+
+	return certificate, nil
+}
+
+func printSamlDecoded(decoded *samlDecoded) {
+	printField := func(name string, value string) {
+		if value != "" {
+			fmt.Printf("%-18s %s\n", name+":", value)
+		}
+	}
+
+	printField("Issuer", decoded.Issuer)
+	printField("Destination", decoded.Destination)
+	printField("Recipient", decoded.Recipient)
+	if decoded.Encrypted {
+		printField("Assertion", "encrypted")
+	}
+	subject := decoded.Subject
+	if decoded.SubjectFormat != "" {
+		subject = fmt.Sprintf("%s (%s)", subject, decoded.SubjectFormat)
+	}
+	printField("Subject", subject)
+	printField("Not Before", decoded.NotBefore)
+	printField("Not On Or After", decoded.NotOnOrAfter)
+	printField("Audience", strings.Join(decoded.Audiences, ", "))
+	printField("Session Duration", decoded.SessionDuration)
+	printField("Role Session Name", decoded.RoleSessionName)
+
+	fmt.Println("Attributes:")
+	for _, attr := range decoded.Attributes {
+		fmt.Printf("  %s\n", attr.Name)
+		for _, val := range attr.Values {
+			fmt.Printf("    %s\n", val)
+		}
+	}
+
+	if decoded.Certificate == nil {
+		fmt.Println("Certificate:       none, the response isn't signed")
+		return
+	}
+
+	fmt.Println("Certificate:")
+	fmt.Printf("  Subject:       %s\n", decoded.Certificate.Subject)
+	fmt.Printf("  Issuer:        %s\n", decoded.Certificate.Issuer)
+	fmt.Printf("  Serial Number: %s\n", decoded.Certificate.SerialNumber)
+	fmt.Printf("  Not Before:    %s\n", decoded.Certificate.NotBefore.Format(timeFormat))
+	fmt.Printf("  Not After:     %s\n", decoded.Certificate.NotAfter.Format(timeFormat))
+	fmt.Printf("  SHA1:          %s\n", decoded.Certificate.Sha1Fingerprint)
+	fmt.Printf("  SHA256:        %s\n", decoded.Certificate.Sha256Fingerprint)
+}
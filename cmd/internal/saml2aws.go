@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"strconv"
+)
+
+const formatSaml2aws = "saml2aws"
+
+const (
+	saml2awsProviderAzure = "AzureAD"
+	saml2awsProviderOkta  = "Okta"
+	saml2awsAzureUrl      = "https://account.activedirectory.windowsazure.com"
+)
+
+func init() {
+	registerConfigConverter(formatSaml2aws, &configConverter{
+		defaultFileName: ".saml2aws",
+		read:            readSaml2aws,
+		write:           writeSaml2aws,
+	})
+}
+
+// readSaml2aws reads the idp accounts of ~/.saml2aws. The profiles are named
+// by the AWS profile of the account, or the account when it has none or
+// shares it with other accounts
+func readSaml2aws(file *ini.File) (map[string]*configuration, error) {
+	configs := make(map[string]*configuration)
+
+	profiles, err := saml2awsProfileNames(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, section := range file.Sections() {
+		if !section.HasKey("provider") {
+			continue
+		}
+
+		profile := profiles[section.Name()]
+		config := &configuration{
+			Region:               section.Key("region").String(),
+			DefaultDurationHours: sessionHours(section.Key("aws_session_duration").String()),
+		}
+		applyRoleArn(config, section.Key("role_arn").String())
+
+		switch provider := section.Key("provider").String(); provider {
+		case saml2awsProviderAzure:
+			// saml2aws finds the tenant from the login, and its app_id is
+			// the id of the app rather than its identifier uri
+			config.AzureUsername = section.Key("username").String()
+			warnMissingValue(profile, "azure_tenant_id")
+			warnMissingValue(profile, "azure_app_id_uri")
+		case saml2awsProviderOkta:
+			config.Idp = idpOkta
+			config.OktaAppUrl = section.Key("url").String()
+			config.OktaUsername = section.Key("username").String()
+		default:
+			warn("%s uses %s, which awsure doesn't support. skipping it", section.Name(), provider)
+			continue
+		}
+
+		configs[profile] = config
+	}
+
+	return configs, nil
+}
+
+// saml2awsProfileNames returns the profile name of each account. Accounts
+// often share saml2aws' default AWS profile, saml, and are then named by the
+// account instead
+func saml2awsProfileNames(file *ini.File) (map[string]string, error) {
+	awsProfile := func(section *ini.Section) string {
+		return section.Key("aws_profile").MustString(section.Name())
+	}
+
+	shared := make(map[string]int)
+	for _, section := range file.Sections() {
+		if section.HasKey("provider") {
+			shared[awsProfile(section)]++
+		}
+	}
+
+	profiles := make(map[string]string)
+	accounts := make(map[string]string)
+	for _, section := range file.Sections() {
+		if !section.HasKey("provider") {
+			continue
+		}
+
+		profile := awsProfile(section)
+		if shared[profile] > 1 {
+			warn("%d accounts use the aws profile %s. importing %s as %s", shared[profile], profile, section.Name(), section.Name())
+			profile = section.Name()
+		}
+
+		if account, exists := accounts[profile]; exists {
+			return nil, fmt.Errorf("the saml2aws accounts %s and %s would both be imported as %s. give one of them its own aws_profile", account, section.Name(), profile)
+		}
+		accounts[profile] = section.Name()
+		profiles[section.Name()] = profile
+	}
+
+	return profiles, nil
+}
+
+func writeSaml2aws(configs map[string]*configuration) (*ini.File, error) {
+	file := ini.Empty()
+
+	for _, profile := range sortedProfiles(configs) {
+		config := configs[profile]
+
+		section, err := file.NewSection(profile)
+		if err != nil {
+			return nil, err
+		}
+
+		provider := saml2awsProviderAzure
+		url := saml2awsAzureUrl
+		username := config.AzureUsername
+		if config.Idp == idpOkta {
+			provider = saml2awsProviderOkta
+			url = config.OktaAppUrl
+			username = config.OktaUsername
+		} else {
+			warn("saml2aws needs the app_id of the Azure app for %s. add it to the file", profile)
+		}
+
+		values := [][2]string{
+			{"name", profile},
+			{"app_id", ""},
+			{"url", url},
+			{"username", username},
+			{"provider", provider},
+			{"mfa", "Auto"},
+			{"aws_urn", "urn:amazon:webservices"},
+			{"aws_session_duration", strconv.Itoa(clampHours(config.DefaultDurationHours) * 3600)},
+			{"aws_profile", profile},
+			{"role_arn", exportedRoleArn(profile, config, formatSaml2aws)},
+			{"region", config.Region},
+		}
+		for _, value := range values {
+			_, _ = section.NewKey(value[0], value[1])
+		}
+	}
+
+	return file, nil
+}
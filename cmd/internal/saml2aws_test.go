@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"gopkg.in/ini.v1"
+	"reflect"
+	"testing"
+)
+
+func TestSaml2awsProfileNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "named by the aws profile",
+			content: `[prod]
+provider = Okta
+aws_profile = production
+
+[dev]
+provider = AzureAD
+`,
+			want: map[string]string{"prod": "production", "dev": "dev"},
+		},
+		{
+			name: "accounts sharing an aws profile are named by the account",
+			content: `[prod]
+provider = Okta
+aws_profile = saml
+
+[dev]
+provider = Okta
+aws_profile = saml
+
+[sandbox]
+provider = Okta
+aws_profile = personal
+`,
+			want: map[string]string{"prod": "prod", "dev": "dev", "sandbox": "personal"},
+		},
+		{
+			name: "sections without a provider are left out",
+			content: `[default]
+region = eu-west-1
+
+[prod]
+provider = Okta
+`,
+			want: map[string]string{"prod": "prod"},
+		},
+		{
+			name: "an account named like the aws profile of another",
+			content: `[prod]
+provider = Okta
+aws_profile = saml
+
+[dev]
+provider = Okta
+aws_profile = saml
+
+[other]
+provider = Okta
+aws_profile = prod
+`,
+			wantErr: "the saml2aws accounts prod and other would both be imported as prod. give one of them its own aws_profile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ini.Load([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := saml2awsProfileNames(file)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("saml2awsProfileNames() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("saml2awsProfileNames() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("saml2awsProfileNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSaml2aws(t *testing.T) {
+	file, err := ini.Load([]byte(`[prod]
+provider = Okta
+url = https://example.okta.com/home/amazon_aws/0oa1/272
+username = user@example.com
+aws_profile = saml
+aws_session_duration = 7200
+region = eu-west-1
+
+[dev]
+provider = AzureAD
+username = user@example.com
+aws_profile = saml
+aws_session_duration = 3600
+
+[legacy]
+provider = Ping
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readSaml2aws(file)
+	if err != nil {
+		t.Fatalf("readSaml2aws() error = %v", err)
+	}
+
+	want := map[string]*configuration{
+		"prod": {
+			Idp:                  idpOkta,
+			OktaAppUrl:           "https://example.okta.com/home/amazon_aws/0oa1/272",
+			OktaUsername:         "user@example.com",
+			DefaultDurationHours: 2,
+			Region:               "eu-west-1",
+		},
+		"dev": {
+			AzureUsername:        "user@example.com",
+			DefaultDurationHours: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readSaml2aws() = %+v, want %+v", got, want)
+	}
+}
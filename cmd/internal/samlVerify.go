@@ -0,0 +1,361 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const samlMetadataCacheTtl = 24 * time.Hour
+
+// samlClockSkew is how far the clocks of the identity provider and this
+// machine may be apart
+const samlClockSkew = 2 * time.Minute
+
+const awsSamlAudience = "urn:amazon:webservices"
+
+// verifiesSaml reports whether the SAML responses of the profile are verified
+// before they are used
+func (c *configuration) verifiesSaml() bool {
+	return c.VerifySaml || c.SamlCertificate != "" || c.SamlMetadataUrl != ""
+}
+
+// verifySaml checks that the SAML response is meant for AWS and is valid now.
+// When a certificate or a metadata url is configured, it also checks that the
+// response is signed by the identity provider.
+func verifySaml(ctx context.Context, config *configuration, options types.Configuration, saml string) error {
+	if !config.verifiesSaml() {
+		return nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(saml)
+	if err != nil {
+		return fmt.Errorf("failed to decode the SAML response: %v", err)
+	}
+
+	response := &samlResponse{}
+	err = xml.Unmarshal(content, response)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal the SAML response: %v", err)
+	}
+
+	if response.EncryptedAssertion != nil && response.Assertion.XMLName.Local == "" {
+		return encryptedAssertionError
+	}
+
+	if config.SamlCertificate != "" || config.SamlMetadataUrl != "" {
+		certificates, err := samlSigningCertificates(ctx, config, options)
+		if err != nil {
+			return err
+		}
+
+		err = verifySamlSignature(content, certificates)
+		if err != nil {
+			return err
+		}
+	}
+
+	return verifySamlConditions(config, response, time.Now())
+}
+
+func verifySamlSignature(content []byte, certificates []*x509.Certificate) error {
+	doc := etree.NewDocument()
+	err := doc.ReadFromBytes(content)
+	if err != nil {
+		return fmt.Errorf("failed to read the SAML response: %v", err)
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return fmt.Errorf("the SAML response is empty")
+	}
+
+	// Only one assertion is allowed, so the one that's verified is the one
+	// the roles are read from
+	assertions := root.FindElements("./Assertion")
+	if len(assertions) != 1 || len(doc.FindElements("//Assertion")) != 1 {
+		return fmt.Errorf("%w: the SAML response must have exactly one assertion", samlVerificationError)
+	}
+
+	validationContext := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certificates})
+
+	signed := assertions[0]
+	if root.FindElement("./Signature") != nil {
+		signed = root
+	}
+	if signed.FindElement("./Signature") == nil {
+		return fmt.Errorf("%w: the SAML response isn't signed", samlVerificationError)
+	}
+
+	_, err = validationContext.Validate(signed)
+	if err != nil {
+		return fmt.Errorf("%w: the signature is invalid: %v", samlVerificationError, err)
+	}
+
+	return nil
+}
+
+func verifySamlConditions(config *configuration, response *samlResponse, now time.Time) error {
+	assertion := response.Assertion
+
+	if len(assertion.Conditions.Audiences) > 0 {
+		found := false
+		for _, audience := range assertion.Conditions.Audiences {
+			if isAwsSamlAudience(config, strings.TrimSpace(audience)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: the audience %s isn't AWS", samlVerificationError, strings.Join(assertion.Conditions.Audiences, ", "))
+		}
+	}
+
+	for _, destination := range []string{response.Destination, assertion.Subject.SubjectConfirmationData.Recipient} {
+		if destination != "" && !isAwsSamlDestination(config, destination) {
+			return fmt.Errorf("%w: the SAML response is addressed to %s instead of AWS", samlVerificationError, destination)
+		}
+	}
+
+	notBefore, err := parseSamlTime(assertion.Conditions.NotBefore)
+	if err != nil {
+		return err
+	}
+	if !notBefore.IsZero() && now.Add(samlClockSkew).Before(notBefore) {
+		return fmt.Errorf("%w: the SAML response isn't valid before %s. please check the clock of this machine", samlVerificationError, notBefore.Local().Format(timeFormat))
+	}
+
+	for _, value := range []string{assertion.Conditions.NotOnOrAfter, assertion.Subject.SubjectConfirmationData.NotOnOrAfter} {
+		notOnOrAfter, err := parseSamlTime(value)
+		if err != nil {
+			return err
+		}
+		if !notOnOrAfter.IsZero() && !now.Add(-samlClockSkew).Before(notOnOrAfter) {
+			return fmt.Errorf("%w: the SAML response expired at %s", samlVerificationError, notOnOrAfter.Local().Format(timeFormat))
+		}
+	}
+
+	return nil
+}
+
+func isAwsSamlAudience(config *configuration, audience string) bool {
+	if audience == awsSamlAudience || (config.AzureAppIdUri != "" && audience == config.AzureAppIdUri) {
+		return true
+	}
+	return isAwsSamlDestination(config, audience)
+}
+
+// isAwsSamlDestination reports whether destination is the SAML endpoint of AWS
+// in any region, or the loopback url the response is posted to
+func isAwsSamlDestination(config *configuration, destination string) bool {
+	if config.LoopbackUrl != "" && destination == config.LoopbackUrl {
+		return true
+	}
+
+	destinationUrl, err := url.Parse(destination)
+	if err != nil || destinationUrl.Scheme != "https" {
+		return false
+	}
+
+	host := destinationUrl.Hostname()
+	return (host == "signin.aws.amazon.com" || strings.HasSuffix(host, ".signin.aws.amazon.com") ||
+		host == "signin.amazonaws-us-gov.com" || host == "signin.amazonaws.cn") &&
+		destinationUrl.Path == "/saml"
+}
+
+func parseSamlTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid time %s", samlVerificationError, value)
+	}
+	return t, nil
+}
+
+// samlSigningCertificates returns the certificates the identity provider signs
+// with, from saml_certificate or from the federation metadata at
+// saml_metadata_url
+func samlSigningCertificates(ctx context.Context, config *configuration, options types.Configuration) ([]*x509.Certificate, error) {
+	if config.SamlCertificate != "" {
+		content, err := os.ReadFile(config.SamlCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the SAML certificate: %v", err)
+		}
+
+		certificates, err := parseSamlCertificates(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(certificates) == 0 {
+			return nil, fmt.Errorf("the SAML certificate file %s has no certificates", config.SamlCertificate)
+		}
+		return certificates, nil
+	}
+
+	content, err := samlMetadata(ctx, config, options)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := samlMetadataDocument{}
+	err = xml.Unmarshal(content, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the SAML metadata: %v", err)
+	}
+
+	var certificates []*x509.Certificate
+	for _, descriptor := range metadata.IdpDescriptors {
+		for _, key := range descriptor.KeyDescriptors {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+
+			certificate, err := parseBase64Certificate(key.Certificate)
+			if err != nil {
+				return nil, err
+			}
+			certificates = append(certificates, certificate)
+		}
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("the SAML metadata at %s has no signing certificates", config.SamlMetadataUrl)
+	}
+
+	return certificates, nil
+}
+
+// parseSamlCertificates parses a PEM file, or a single DER encoded certificate
+func parseSamlCertificates(content []byte) ([]*x509.Certificate, error) {
+	if !strings.Contains(string(content), "-----BEGIN") {
+		certificate, err := x509.ParseCertificate(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the SAML certificate: %v", err)
+		}
+		return []*x509.Certificate{certificate}, nil
+	}
+
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the SAML certificate: %v", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
+
+func parseBase64Certificate(encoded string) (*x509.Certificate, error) {
+	content, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode a certificate of the SAML metadata: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse a certificate of the SAML metadata: %v", err)
+	}
+	return certificate, nil
+}
+
+// samlMetadata returns the federation metadata at saml_metadata_url. It's
+// cached on disk for a day, and the cached copy is used when it can't be
+// downloaded
+func samlMetadata(ctx context.Context, config *configuration, options types.Configuration) ([]byte, error) {
+	hash := sha256.Sum256([]byte(config.SamlMetadataUrl))
+	cachePath := filepath.Join(defaultSamlMetadataDirectory, hex.EncodeToString(hash[:])[:32]+".xml")
+
+	info, err := os.Stat(cachePath)
+	if err == nil && time.Since(info.ModTime()) < samlMetadataCacheTtl {
+		content, err := os.ReadFile(cachePath)
+		if err == nil {
+			return content, nil
+		}
+	}
+
+	content, err := downloadSamlMetadata(ctx, config, options)
+	if err != nil {
+		cached, cacheErr := os.ReadFile(cachePath)
+		if cacheErr != nil {
+			return nil, err
+		}
+
+		warn("couldn't update the SAML metadata, using the cached copy: %v", err)
+		return cached, nil
+	}
+
+	err = os.MkdirAll(defaultSamlMetadataDirectory, 0700)
+	if err == nil {
+		err = os.WriteFile(cachePath, content, 0600)
+	}
+	if err != nil {
+		warn("couldn't cache the SAML metadata: %v", err)
+	}
+
+	return content, nil
+}
+
+func downloadSamlMetadata(ctx context.Context, config *configuration, options types.Configuration) ([]byte, error) {
+	client, err := newHttpClient(resolveBrowserSettings(config))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.SamlMetadataUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML metadata url %s: %v", config.SamlMetadataUrl, err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the SAML metadata: %v", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the SAML metadata: %s", res.Status)
+	}
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the SAML metadata: %v", err)
+	}
+
+	err = xml.Unmarshal(content, &samlMetadataDocument{})
+	if err != nil {
+		return nil, fmt.Errorf("the SAML metadata url %s didn't return XML", config.SamlMetadataUrl)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,397 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testRoleArn      = "arn:aws:iam::123456789012:role/Admin"
+	testProviderArn  = "arn:aws:iam::123456789012:saml-provider/AzureAD"
+	otherRoleArn     = "arn:aws:iam::210987654321:role/ReadOnly"
+	otherProviderArn = "arn:aws:iam::210987654321:saml-provider/AzureAD"
+	govRoleArn       = "arn:aws-us-gov:iam::123456789012:role/Admin"
+	govProviderArn   = "arn:aws-us-gov:iam::123456789012:saml-provider/AzureAD"
+)
+
+func TestParseSamlRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    role
+		wantErr bool
+	}{
+		{
+			name:  "role then provider",
+			value: testRoleArn + "," + testProviderArn,
+			want:  role{roleArn: testRoleArn, principalArn: testProviderArn},
+		},
+		{
+			name:  "provider then role",
+			value: testProviderArn + "," + testRoleArn,
+			want:  role{roleArn: testRoleArn, principalArn: testProviderArn},
+		},
+		{
+			name:  "spaces around the comma",
+			value: "  " + testRoleArn + " , " + testProviderArn + "  ",
+			want:  role{roleArn: testRoleArn, principalArn: testProviderArn},
+		},
+		{
+			name:  "newlines and tabs in the value",
+			value: "\n\t" + testRoleArn + ",\n\t" + testProviderArn + "\n",
+			want:  role{roleArn: testRoleArn, principalArn: testProviderArn},
+		},
+		{
+			name:  "role with a path",
+			value: "arn:aws:iam::123456789012:role/teams/dev/Admin," + testProviderArn,
+			want:  role{roleArn: "arn:aws:iam::123456789012:role/teams/dev/Admin", principalArn: testProviderArn},
+		},
+		{
+			name:  "govcloud",
+			value: govRoleArn + "," + govProviderArn,
+			want:  role{roleArn: govRoleArn, principalArn: govProviderArn},
+		},
+		{
+			name:  "govcloud swapped",
+			value: govProviderArn + "," + govRoleArn,
+			want:  role{roleArn: govRoleArn, principalArn: govProviderArn},
+		},
+		{
+			name:  "china partition",
+			value: "arn:aws-cn:iam::123456789012:role/Admin,arn:aws-cn:iam::123456789012:saml-provider/AzureAD",
+			want:  role{roleArn: "arn:aws-cn:iam::123456789012:role/Admin", principalArn: "arn:aws-cn:iam::123456789012:saml-provider/AzureAD"},
+		},
+		{
+			name:    "empty",
+			value:   "",
+			wantErr: true,
+		},
+		{
+			name:    "role only",
+			value:   testRoleArn,
+			wantErr: true,
+		},
+		{
+			name:    "trailing comma",
+			value:   testRoleArn + ",",
+			wantErr: true,
+		},
+		{
+			name:    "three parts",
+			value:   testRoleArn + "," + testProviderArn + "," + testProviderArn,
+			wantErr: true,
+		},
+		{
+			name:    "two roles",
+			value:   testRoleArn + "," + otherRoleArn,
+			wantErr: true,
+		},
+		{
+			name:    "two providers",
+			value:   testProviderArn + "," + otherProviderArn,
+			wantErr: true,
+		},
+		{
+			name:    "short account id",
+			value:   "arn:aws:iam::12345:role/Admin,arn:aws:iam::12345:saml-provider/AzureAD",
+			wantErr: true,
+		},
+		{
+			name:    "not an iam arn",
+			value:   "arn:aws:sts::123456789012:assumed-role/Admin," + testProviderArn,
+			wantErr: true,
+		},
+		{
+			name:    "cross account",
+			value:   testRoleArn + "," + otherProviderArn,
+			wantErr: true,
+		},
+		{
+			name:    "cross account swapped",
+			value:   otherProviderArn + "," + testRoleArn,
+			wantErr: true,
+		},
+		{
+			name:    "mixed partitions",
+			value:   govRoleArn + "," + testProviderArn,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseSamlRole(test.value)
+			if test.wantErr {
+				if !errors.Is(err, invalidSamlRoleError) {
+					t.Fatalf("parseSamlRole(%q) returned %v, want an invalid SAML role error", test.value, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseSamlRole(%q) returned %v", test.value, err)
+			}
+			if got != test.want {
+				t.Fatalf("parseSamlRole(%q) = %+v, want %+v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSamlResponseRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		saml    string
+		want    []role
+		wantErr error
+	}{
+		{
+			name: "single role",
+			saml: testSamlResponse(testRoleArn + "," + testProviderArn),
+			want: []role{{roleArn: testRoleArn, principalArn: testProviderArn}},
+		},
+		{
+			name: "roles in order",
+			saml: testSamlResponse(testRoleArn+","+testProviderArn, otherRoleArn+","+otherProviderArn),
+			want: []role{
+				{roleArn: testRoleArn, principalArn: testProviderArn},
+				{roleArn: otherRoleArn, principalArn: otherProviderArn},
+			},
+		},
+		{
+			name: "swapped order in some values",
+			saml: testSamlResponse(testProviderArn+","+testRoleArn, otherRoleArn+","+otherProviderArn),
+			want: []role{
+				{roleArn: testRoleArn, principalArn: testProviderArn},
+				{roleArn: otherRoleArn, principalArn: otherProviderArn},
+			},
+		},
+		{
+			name: "duplicates",
+			saml: testSamlResponse(testRoleArn+","+testProviderArn, testProviderArn+","+testRoleArn, "\n  "+testRoleArn+",\n  "+testProviderArn+"\n"),
+			want: []role{{roleArn: testRoleArn, principalArn: testProviderArn}},
+		},
+		{
+			name: "whitespace in values",
+			saml: testSamlResponse("\n\t\t" + govRoleArn + ",\n\t\t" + govProviderArn + "\n\t"),
+			want: []role{{roleArn: govRoleArn, principalArn: govProviderArn}},
+		},
+		{
+			name: "invalid values are skipped",
+			saml: testSamlResponse("not-a-role", testRoleArn+","+otherProviderArn, otherRoleArn+","+otherProviderArn),
+			want: []role{{roleArn: otherRoleArn, principalArn: otherProviderArn}},
+		},
+		{
+			name:    "only invalid values",
+			saml:    testSamlResponse("not-a-role", testRoleArn+","+otherProviderArn),
+			wantErr: invalidSamlRoleError,
+		},
+		{
+			name: "no role attribute",
+			saml: testSamlResponse(),
+		},
+		{
+			name: "encrypted assertion",
+			saml: `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:EncryptedAssertion><xenc:EncryptedData xmlns:xenc="http://www.w3.org/2001/04/xmlenc#"/></saml:EncryptedAssertion>
+</samlp:Response>`,
+			wantErr: encryptedAssertionError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := decodeSamlResponse(normalizeSamlInput(test.saml))
+			if err != nil {
+				t.Fatalf("decodeSamlResponse returned %v", err)
+			}
+
+			got, err := response.roles()
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("roles() returned %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("roles() returned %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("roles() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// testSamlResponse returns a SAML response whose role attribute has the values
+func testSamlResponse(roleValues ...string) string {
+	var attribute string
+	if len(roleValues) > 0 {
+		var values strings.Builder
+		for _, value := range roleValues {
+			values.WriteString(fmt.Sprintf("<saml:AttributeValue>%s</saml:AttributeValue>", value))
+		}
+		attribute = fmt.Sprintf(`<saml:Attribute Name="%s">%s</saml:Attribute>`, samlRoleAttribute, values.String())
+	}
+
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="%s"><saml:AttributeValue>user@example.com</saml:AttributeValue></saml:Attribute>
+      %s
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`, samlRoleSessionNameAttribute, attribute)
+}
+
+// TestSamlResponseFixtures reads sanitized responses of Azure AD, Okta and
+// ADFS, which differ in their namespaces, signatures, whitespace and the order
+// of the role values
+func TestSamlResponseFixtures(t *testing.T) {
+	tests := []struct {
+		fixture         string
+		want            []role
+		wantSessionName string
+		wantDuration    int32
+		wantSubject     string
+		wantCertificate string
+		validAt         time.Time
+	}{
+		{
+			fixture: "azure",
+			want: []role{
+				{roleArn: testRoleArn, principalArn: testProviderArn},
+				{roleArn: otherRoleArn, principalArn: otherProviderArn},
+			},
+			wantSessionName: "user@example.com",
+			wantDuration:    28800,
+			wantSubject:     "user@example.com",
+			wantCertificate: "CN=Microsoft Azure Federated SSO Certificate",
+			validAt:         time.Date(2024, 5, 2, 10, 16, 0, 0, time.UTC),
+		},
+		{
+			// The cross account value is skipped
+			fixture: "okta",
+			want: []role{
+				{roleArn: "arn:aws:iam::123456789012:role/Developer", principalArn: "arn:aws:iam::123456789012:saml-provider/Okta"},
+				{roleArn: "arn:aws:iam::123456789012:role/ReadOnly", principalArn: "arn:aws:iam::123456789012:saml-provider/Okta"},
+			},
+			wantSessionName: "user@example.com",
+			wantDuration:    3600,
+			wantSubject:     "user@example.com",
+			wantCertificate: "CN=example",
+			validAt:         time.Date(2024, 5, 2, 10, 16, 0, 0, time.UTC),
+		},
+		{
+			fixture: "adfs",
+			want: []role{
+				{roleArn: "arn:aws:iam::123456789012:role/ADFS-Production", principalArn: "arn:aws:iam::123456789012:saml-provider/ADFS"},
+				{roleArn: "arn:aws:iam::123456789012:role/ADFS-Dev", principalArn: "arn:aws:iam::123456789012:saml-provider/ADFS"},
+			},
+			wantSessionName: "user@example.com",
+			wantDuration:    43200,
+			wantSubject:     `EXAMPLE\user`,
+			wantCertificate: "CN=ADFS Signing - adfs.example.com",
+			validAt:         time.Date(2024, 5, 2, 10, 16, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			content := readSamlFixture(t, test.fixture+".xml")
+			response, err := decodeSamlResponse(base64.StdEncoding.EncodeToString(content))
+			if err != nil {
+				t.Fatalf("decodeSamlResponse returned %v", err)
+			}
+
+			roles, err := response.roles()
+			if err != nil {
+				t.Fatalf("roles() returned %v", err)
+			}
+			if !reflect.DeepEqual(roles, test.want) {
+				t.Errorf("roles() = %+v, want %+v", roles, test.want)
+			}
+
+			if name := response.roleSessionName(); name != test.wantSessionName {
+				t.Errorf("roleSessionName() = %q, want %q", name, test.wantSessionName)
+			}
+
+			duration, err := response.sessionDuration()
+			if err != nil || duration != test.wantDuration {
+				t.Errorf("sessionDuration() = %d, %v, want %d", duration, err, test.wantDuration)
+			}
+
+			decoded, err := response.decoded()
+			if err != nil {
+				t.Fatalf("decoded() returned %v", err)
+			}
+			if decoded.Subject != test.wantSubject {
+				t.Errorf("subject = %q, want %q", decoded.Subject, test.wantSubject)
+			}
+			if decoded.Certificate == nil || decoded.Certificate.Subject != test.wantCertificate {
+				t.Errorf("certificate = %+v, want the subject %s", decoded.Certificate, test.wantCertificate)
+			}
+
+			err = verifySamlConditions(&configuration{}, response, test.validAt)
+			if err != nil {
+				t.Errorf("verifySamlConditions() returned %v", err)
+			}
+			err = verifySamlConditions(&configuration{}, response, test.validAt.Add(2*time.Hour))
+			if !errors.Is(err, samlVerificationError) {
+				t.Errorf("verifySamlConditions() two hours later returned %v, want an expired response", err)
+			}
+		})
+	}
+}
+
+func TestVerifySamlSignatureFixtures(t *testing.T) {
+	for _, fixture := range []string{"azure", "okta", "adfs"} {
+		t.Run(fixture, func(t *testing.T) {
+			content := readSamlFixture(t, fixture+".xml")
+			certificates, err := parseSamlCertificates(readSamlFixture(t, fixture+".pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = verifySamlSignature(content, certificates)
+			if err != nil {
+				t.Errorf("verifySamlSignature() returned %v", err)
+			}
+
+			tampered := []byte(strings.Replace(string(content), "user@example.com", "admin@example.com", 1))
+			err = verifySamlSignature(tampered, certificates)
+			if !errors.Is(err, samlVerificationError) {
+				t.Errorf("verifySamlSignature() of a changed response returned %v, want a verification error", err)
+			}
+
+			other := "azure"
+			if fixture == other {
+				other = "okta"
+			}
+			otherCertificates, err := parseSamlCertificates(readSamlFixture(t, other+".pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = verifySamlSignature(content, otherCertificates)
+			if !errors.Is(err, samlVerificationError) {
+				t.Errorf("verifySamlSignature() with the certificate of %s returned %v, want a verification error", other, err)
+			}
+		})
+	}
+}
+
+func readSamlFixture(t *testing.T, name string) []byte {
+	content, err := os.ReadFile(filepath.Join("testdata", "saml", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderConfigKeys are the values of a person that shared configs leave
+// placeholders for, which importing asks for
+var placeholderConfigKeys = []string{"azure_username", "okta_username"}
+
+// personalConfigKeys are the preferences and machine settings of a person,
+// which shared configs leave out
+var personalConfigKeys = []string{"remember_me", "browser_url", "browser_path", "browser_args", "browser_no_sandbox", "ca_bundle", "saml_certificate"}
+
+var placeholderPattern = regexp.MustCompile(`^<([a-z_]+)>$`)
+
+func placeholder(key string) string {
+	return fmt.Sprintf("<%s>", key)
+}
+
+// exportSharedConfig writes a config others can import, without personal
+// values and with placeholders for their own
+func exportSharedConfig(path string, configFile *configurationFile) error {
+	addUsernamePlaceholders(configFile)
+
+	root := &yaml.Node{}
+	err := root.Encode(configFile)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range configEntries(root) {
+		var content []*yaml.Node
+		for i := 0; i+1 < len(entry.Content); i += 2 {
+			key := entry.Content[i].Value
+			value := entry.Content[i+1]
+
+			switch {
+			case contains(personalConfigKeys, key):
+				continue
+			case contains(placeholderConfigKeys, key):
+				value.Kind = yaml.ScalarNode
+				value.Tag = "!!str"
+				value.Value = placeholder(key)
+			case key == "proxy":
+				value.Value = withoutUserinfo(value.Value)
+			}
+			content = append(content, entry.Content[i], value)
+		}
+		entry.Content = content
+	}
+
+	content, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// addUsernamePlaceholders gives every identity, and every profile that
+// doesn't inherit one, the username placeholder of its identity provider, so
+// importing always asks for it
+func addUsernamePlaceholders(configFile *configurationFile) {
+	for _, block := range configFile.Identities {
+		if block == nil {
+			continue
+		}
+		if block.Idp == idpOkta {
+			block.OktaUsername = placeholder("okta_username")
+		} else {
+			block.AzureUsername = placeholder("azure_username")
+		}
+	}
+
+	for profile, config := range configFile.Configs {
+		if config == nil {
+			config = &configuration{}
+			configFile.Configs[profile] = config
+		}
+
+		resolved, err := configFile.resolve(config)
+		if err != nil {
+			continue
+		}
+		if resolved.Idp == idpOkta && resolved.OktaUsername == "" {
+			config.OktaUsername = placeholder("okta_username")
+		} else if resolved.Idp != idpOkta && resolved.AzureUsername == "" {
+			config.AzureUsername = placeholder("azure_username")
+		}
+	}
+}
+
+// withoutUserinfo removes the credentials of a proxy url, keeping the proxy
+// the team shares
+func withoutUserinfo(proxy string) string {
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.User == nil {
+		return proxy
+	}
+	proxyUrl.User = nil
+	return proxyUrl.String()
+}
+
+// fillPlaceholders asks for the values the placeholders of a shared config
+// stand for. Each one is asked once and used wherever it appears
+func fillPlaceholders(configFile *configurationFile, dryRun bool) (*configurationFile, error) {
+	root := &yaml.Node{}
+	err := root.Encode(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := make(map[string][]*yaml.Node)
+	for _, entry := range configEntries(root) {
+		for i := 1; i < len(entry.Content); i += 2 {
+			match := placeholderPattern.FindStringSubmatch(entry.Content[i].Value)
+			if match != nil && match[1] == entry.Content[i-1].Value {
+				placeholders[match[1]] = append(placeholders[match[1]], entry.Content[i])
+			}
+		}
+	}
+	if len(placeholders) == 0 {
+		return configFile, nil
+	}
+
+	var keys []string
+	for key := range placeholders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if dryRun {
+		fmt.Printf("You would be asked for %s\n", strings.Join(keys, ", "))
+		return configFile, nil
+	}
+
+	prompter := Prompter{}
+	for _, key := range keys {
+		value, err := prompter.ValidatedPrompt(keyLabel(key), "", func(input string) error {
+			input = strings.TrimSpace(input)
+			if input == "" {
+				return fmt.Errorf("%s is required", keyLabel(key))
+			}
+			return validateWizardInput(key, reflect.String, input)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range placeholders[key] {
+			node.Value = strings.TrimSpace(value)
+		}
+	}
+
+	filled := &configurationFile{}
+	err = root.Decode(filled)
+	if err != nil {
+		return nil, err
+	}
+	return filled, nil
+}
+
+// configEntries returns the identities, defaults and profiles of the file
+func configEntries(root *yaml.Node) []*yaml.Node {
+	var entries []*yaml.Node
+	for _, section := range []string{"identities", "defaults", "configs"} {
+		blocks := mappingValue(root, section)
+		if blocks == nil || blocks.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 1; i < len(blocks.Content); i += 2 {
+			if blocks.Content[i].Kind == yaml.MappingNode {
+				entries = append(entries, blocks.Content[i])
+			}
+		}
+	}
+	return entries
+}
+
+// keyLabel turns a key like azure_username into Azure Username
+func keyLabel(key string) string {
+	words := strings.Split(key, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -2,9 +2,30 @@ package internal
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
+// startSpinner shows the spinner until the returned function is called. The
+// returned function can be called more than once
+func startSpinner() func() {
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		spinner(stopChan)
+		close(done)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopChan)
+			<-done
+		})
+	}
+}
+
 func spinner(stopChan chan struct{}) {
 	clearLine := "\r\033[K"
 	scannerFrames := []rune(`⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏`)
@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	fillUsernameAction  = "fill_username"
+	fillSecretAction    = "fill_secret"
+	clickAction         = "click"
+	promptAndFillAction = "prompt_and_fill"
+	printTextAction     = "print_text"
+	failAction          = "fail"
+)
+
+const customStatePackName = "custom"
+
+var loginStatePacks = map[string]*loginStatePack{}
+var loginStatePackOrder []string
+
+// registerLoginStates adds a pack of states for an identity provider. Packs are
+// checked in the order they are registered
+func registerLoginStates(name string, errorStates []LoginState, states []LoginState) {
+	if _, ok := loginStatePacks[name]; !ok {
+		loginStatePackOrder = append(loginStatePackOrder, name)
+	}
+
+	loginStatePacks[name] = &loginStatePack{
+		name:        name,
+		errorStates: errorStates,
+		states:      states,
+	}
+}
+
+// loginStates returns the error states and the states of every registered pack,
+// with the ones from the custom states file first so they can override the
+// built-in ones
+func loginStates() ([]LoginState, []LoginState, error) {
+	var errorStates []LoginState
+	var states []LoginState
+
+	custom, err := loadCustomStatePack()
+	if err != nil && !errors.Is(err, fileNotFoundError) {
+		return nil, nil, err
+	}
+	if custom != nil {
+		errorStates = append(errorStates, custom.errorStates...)
+		states = append(states, custom.states...)
+	}
+
+	for _, name := range loginStatePackOrder {
+		pack := loginStatePacks[name]
+		errorStates = append(errorStates, pack.errorStates...)
+		states = append(states, pack.states...)
+	}
+
+	return errorStates, states, nil
+}
+
+func loadCustomStatePack() (*loginStatePack, error) {
+	_, err := os.Stat(defaultCustomStatesLocation)
+	if os.IsNotExist(err) {
+		return nil, fileNotFoundError
+	}
+
+	content, err := os.ReadFile(defaultCustomStatesLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	file := declarativeStatesFile{}
+	err = yaml.Unmarshal(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read custom states from %s: %v", defaultCustomStatesLocation, err)
+	}
+
+	return declarativeStatePack(customStatePackName, file.States...)
+}
+
+// declarativeStatePack validates the states and splits them into error states
+// and regular states
+func declarativeStatePack(name string, declarativeStates ...*declarativeState) (*loginStatePack, error) {
+	pack := &loginStatePack{name: name}
+
+	for i, st := range declarativeStates {
+		if st.StateName == "" {
+			st.StateName = fmt.Sprintf("%s state #%d", name, i+1)
+		}
+
+		if st.StateSelector == "" {
+			return nil, fmt.Errorf("%s has no selector", st.StateName)
+		}
+
+		switch st.Action {
+		case failAction:
+			pack.errorStates = append(pack.errorStates, st)
+		case fillUsernameAction, fillSecretAction, clickAction, promptAndFillAction, printTextAction:
+			pack.states = append(pack.states, st)
+		default:
+			return nil, fmt.Errorf("%s has an unknown action %q", st.StateName, st.Action)
+		}
+	}
+
+	return pack, nil
+}
+
+func (s *state) Name() string {
+	return s.name
+}
+
+func (s *state) Selector() string {
+	return s.selector
+}
+
+func (s *state) Handle(pg *rod.Page, el *rod.Element, conf *configuration) error {
+	return s.handler(pg, el, conf)
+}
+
+func (s *declarativeState) Name() string {
+	return s.StateName
+}
+
+func (s *declarativeState) Selector() string {
+	return s.StateSelector
+}
+
+func (s *declarativeState) Handle(pg *rod.Page, el *rod.Element, conf *configuration) error {
+	prompter := Prompter{}
+
+	switch s.Action {
+	case fillUsernameAction:
+		// Some pages keep the username input around after it's filled or prefill it
+		value, err := el.Property("value")
+		if err == nil && value.Str() != "" {
+			return nil
+		}
+
+		username, err := s.username(conf)
+		if err != nil {
+			return err
+		}
+
+		err = fillInput(el, username)
+		if err != nil {
+			return err
+		}
+	case fillSecretAction:
+		secret, err := prompter.SensitivePrompt(s.label("Password"))
+		if err != nil {
+			return err
+		}
+
+		err = fillInput(el, secret)
+		if err != nil {
+			return err
+		}
+	case promptAndFillAction:
+		value, err := prompter.Prompt(s.label(s.StateName), "")
+		if err != nil {
+			return err
+		}
+
+		err = fillInput(el, value)
+		if err != nil {
+			return err
+		}
+	case clickAction:
+		err := el.WaitVisible()
+		if err != nil {
+			return err
+		}
+
+		err = clickAndWaitIdle(pg, el)
+		if err != nil {
+			return err
+		}
+	case printTextAction:
+		// The page is checked repeatedly, so the text is only printed when it changes
+		t, _ := el.Text()
+		t = strings.TrimSpace(t)
+		if t != "" && t != s.printedText {
+			fmt.Println(t)
+		}
+		s.printedText = t
+		return nil
+	case failAction:
+		t, _ := el.Text()
+		if err := loginErrorFromText(t); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s: %s", s.StateName, strings.TrimSpace(t))
+	}
+
+	if s.Submit != "" {
+		btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(s.Submit)
+		if err == nil {
+			err = clickAndWaitIdle(pg, btn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	return nil
+}
+
+func (s *declarativeState) username(conf *configuration) (string, error) {
+	username := conf.AzureUsername
+	label := "Azure Username"
+	if s.Username == "okta" {
+		username = conf.OktaUsername
+		label = "Okta Username"
+	}
+
+	if username != "" {
+		return username, nil
+	}
+
+	prompter := Prompter{}
+	return prompter.Prompt(s.label(label), "")
+}
+
+func (s *declarativeState) label(fallback string) string {
+	if s.Label != "" {
+		return s.Label
+	}
+	return fallback
+}
+
+func fillInput(el *rod.Element, value string) error {
+	err := el.WaitVisible()
+	if err != nil {
+		return err
+	}
+
+	err = el.SelectAllText()
+	if err != nil {
+		return err
+	}
+
+	err = el.Input("")
+	if err != nil {
+		return err
+	}
+
+	return el.Input(value)
+}
+
+func clickAndWaitIdle(pg *rod.Page, el *rod.Element) error {
+	wait := pg.WaitRequestIdle(300*time.Millisecond, nil, nil, nil)
+
+	err := el.Click(proto.InputMouseButtonLeft, 1)
+	if err != nil {
+		return err
+	}
+
+	wait()
+	return nil
+}
+
+// clickSelectorAndWaitIdle waits for the element matching selector to be
+// visible and clicks it
+func clickSelectorAndWaitIdle(pg *rod.Page, selector string) error {
+	el, err := pg.Element(selector)
+	if err != nil {
+		return err
+	}
+
+	err = el.WaitVisible()
+	if err != nil {
+		return err
+	}
+
+	return clickAndWaitIdle(pg, el)
+}
+
+// printElementText prints the text of the element matching selector, if any
+func printElementText(pg *rod.Page, selector string) {
+	el, err := pg.Sleeper(rod.NotFoundSleeper).Element(selector)
+	if el == nil || err != nil {
+		return
+	}
+
+	t, _ := el.Text()
+	if t != "" {
+		fmt.Println(t)
+	}
+}
+
+// waitForTransition waits until the element matching selector is gone from the
+// page or race completes, for up to 25 seconds
+func waitForTransition(pg *rod.Page, selector string, race func(pg *rod.Page) *rod.RaceContext) {
+	ctx, cancel := context.WithCancel(pg.GetContext())
+	defer cancel()
+
+	ch := make(chan bool, 1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				_, err := pg.Sleeper(rod.NotFoundSleeper).Element(selector)
+				if err != nil {
+					ch <- true
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		_, err := race(pg.Timeout(20 * time.Second)).Do()
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			ch <- true
+			return
+		}
+	}()
+
+	select {
+	case <-ch:
+	case <-time.After(25 * time.Second):
+	}
+}
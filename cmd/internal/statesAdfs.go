@@ -0,0 +1,28 @@
+package internal
+
+func init() {
+	pack, err := declarativeStatePack("adfs",
+		&declarativeState{
+			StateName:     "ADFS sign in error",
+			StateSelector: `#errorText:not(:empty)`,
+			Action:        failAction,
+		},
+		&declarativeState{
+			StateName:     "ADFS username input",
+			StateSelector: `input#userNameInput:not([disabled])`,
+			Action:        fillUsernameAction,
+		},
+		&declarativeState{
+			StateName:     "ADFS password input",
+			StateSelector: `input#passwordInput:not([disabled])`,
+			Action:        fillSecretAction,
+			Label:         "ADFS Password",
+			Submit:        `#submitButton`,
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	registerLoginStates(pack.name, pack.errorStates, pack.states)
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/go-rod/rod"
+	"log"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerLoginStates("azure", azureErrorStates, azureStates)
+}
+
+var azureErrorStates = []LoginState{
+	&state{
+		name:     "Azure sign in error",
+		selector: `#usernameError,#passwordError,#idTD_Error`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			t, err := el.Text()
+			if err != nil || strings.TrimSpace(t) == "" {
+				return nil
+			}
+
+			if err = loginErrorFromText(t); err != nil {
+				return err
+			}
+			return fmt.Errorf("sign in failed: %s", strings.TrimSpace(t))
+		},
+	},
+}
+
+var azureStates = []LoginState{
+	&state{
+		name:     "username input",
+		selector: `input[name="loginfmt"]:not(.moveOffScreen)`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			var err error
+			username := conf.AzureUsername
+			if username == "" {
+				prompter := Prompter{}
+				username, err = prompter.Prompt("Azure Username", username)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = fillInput(el, strings.TrimSpace(username))
+			if err != nil {
+				return err
+			}
+
+			err = clickSelectorAndWaitIdle(pg, `input[type=submit]`)
+			if err != nil {
+				return err
+			}
+
+			waitForTransition(pg, "input[name=loginfmt]", func(pg *rod.Page) *rod.RaceContext {
+				return pg.Race().
+					Element("input[name=loginfmt].has-error").
+					Element("input[name=loginfmt].moveOffScreen").
+					Element("input[name=loginfmt]").Handle(func(e *rod.Element) error {
+					return e.WaitInvisible()
+				})
+			})
+			return nil
+		},
+	},
+	&state{
+		name:     "password input",
+		selector: `input[name="Password"]:not(.moveOffScreen),input[name="passwd"]:not(.moveOffScreen)`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".alert-error")
+
+			if alert != nil && err == nil {
+				log.Println(alert.Text())
+			}
+
+			prompter := Prompter{}
+			password, err := prompter.SensitivePrompt("Azure Password")
+			if err != nil {
+				return err
+			}
+
+			err = fillInput(el, password)
+			if err != nil {
+				return err
+			}
+
+			err = clickSelectorAndWaitIdle(pg, "span[class=submit],input[type=submit]")
+			if err != nil {
+				return err
+			}
+
+			time.Sleep(time.Millisecond * 500)
+			return nil
+		},
+	},
+	&state{
+		name:     "stay signed in",
+		selector: `#KmsiCheckboxField,input[name="DontShowAgain"]`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			button := `#idBtn_Back`
+			if conf.RememberMe {
+				button = `#idSIButton9`
+			}
+
+			err := clickSelectorAndWaitIdle(pg, button)
+			if err != nil {
+				return err
+			}
+
+			time.Sleep(time.Millisecond * 500)
+			return nil
+		},
+	},
+}
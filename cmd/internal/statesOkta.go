@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"errors"
+	"github.com/go-rod/rod"
+	"log"
+	"time"
+)
+
+const (
+	oktaErrorSelector  = `div.o-form-error-container`
+	oktaInfoSelector   = `div.o-form-info-container`
+	oktaSubmitSelector = `input:not([disabled]):not(.link-button-disabled):not(.btn-disabled)[type=submit]`
+)
+
+func init() {
+	registerLoginStates("okta", oktaErrorStates, oktaStates)
+}
+
+var oktaErrorStates = []LoginState{
+	&state{
+		name:     "OKTA sign in error",
+		selector: oktaErrorSelector + `.o-form-has-errors`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			t, err := el.Text()
+			if err != nil {
+				return nil
+			}
+
+			// Errors that aren't recognized are left to the regular states, which
+			// print them and ask for the input again
+			return loginErrorFromText(t)
+		},
+	},
+}
+
+var oktaStates = []LoginState{
+	&state{
+		name:     "OKTA username input",
+		selector: `form:not(.o-form-saving) > div span.okta-form-input-field input[name="identifier"]:not([disabled])`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			printElementText(pg, oktaErrorSelector)
+			printElementText(pg, oktaInfoSelector)
+
+			var err error
+			username := conf.OktaUsername
+			if username == "" {
+				prompter := Prompter{}
+				username, err = prompter.Prompt("Okta Username", username)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = fillInput(el, username)
+			if err != nil {
+				return err
+			}
+
+			return oktaSubmit(pg)
+		},
+	},
+	&state{
+		name:     "OKTA password input",
+		selector: `div.challenge-authenticator--okta_password.mfa-verify-password input[type="password"]:not([disabled])`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			printElementText(pg, oktaErrorSelector)
+			printElementText(pg, oktaInfoSelector)
+
+			err := el.WaitVisible()
+			if err != nil {
+				return err
+			}
+
+			prompter := Prompter{}
+			password, err := prompter.SensitivePrompt("Okta Password")
+			if err != nil {
+				return err
+			}
+
+			err = el.Input(password)
+			if err != nil {
+				return err
+			}
+
+			return oktaSubmit(pg)
+		},
+	},
+	&state{
+		name:     "OKTA SELECT PUSH Form",
+		selector: `div[data-se="okta_verify-push"] > a:not([disabled]):not(.link-button-disabled):not(.btn-disabled)`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			printElementText(pg, ".infobox-error")
+			return oktaClickIfPresent(pg, `div[data-se="okta_verify-push"] > a:not([disabled]):not(.btn-disabled):not(.link-button-disabled)`)
+		},
+	},
+	&state{
+		name:     "OKTA DO PUSH Form",
+		selector: `a.send-push:not([disabled]):not(.link-button-disabled):not(.btn-disabled)`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			printElementText(pg, ".infobox-error")
+			return oktaClickIfPresent(pg, `a.send-push:not([disabled]):not(.btn-disabled):not(.link-button-disabled)`)
+		},
+	},
+	&state{
+		name:     "MFA input",
+		selector: `div.challenge-authenticator--google_otp.mfa-verify`,
+		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
+			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".alert-error")
+
+			if alert != nil && err == nil {
+				log.Println(alert.Text())
+			}
+
+			prompter := Prompter{}
+			mfa, err := prompter.Prompt("Google Authenticator Code", "")
+			if err != nil {
+				return err
+			}
+
+			input, err := el.Element(`input[name='credentials.passcode']`)
+			if err != nil {
+				return err
+			}
+
+			err = fillInput(input, mfa)
+			if err != nil {
+				return err
+			}
+
+			err = clickSelectorAndWaitIdle(pg, "input[type=submit]")
+			if err != nil {
+				return err
+			}
+
+			time.Sleep(time.Millisecond * 500)
+			return nil
+		},
+	},
+}
+
+// oktaSubmit clicks the submit button of the current Okta form and waits for
+// the form to be replaced or to show an error
+func oktaSubmit(pg *rod.Page) error {
+	time.Sleep(time.Millisecond * 500)
+
+	btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(oktaSubmitSelector)
+	if err != nil {
+		return nil
+	}
+
+	err = clickAndWaitIdle(pg, btn)
+	if err != nil {
+		return err
+	}
+
+	waitForTransition(pg, oktaSubmitSelector, func(pg *rod.Page) *rod.RaceContext {
+		return pg.Race().
+			Element(oktaErrorSelector + `.o-form-has-errors`).Handle(func(e *rod.Element) error {
+			if e != nil {
+				t, _ := e.Text()
+				if t != "" {
+					return errors.New("error returned")
+				}
+			}
+			return nil
+		}).
+			Element(oktaSubmitSelector).Handle(func(e *rod.Element) error {
+			return e.WaitInvisible()
+		})
+	})
+	return nil
+}
+
+func oktaClickIfPresent(pg *rod.Page, selector string) error {
+	btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(selector)
+	if err != nil || btn == nil {
+		return nil
+	}
+
+	err = btn.WaitVisible()
+	if err != nil {
+		return err
+	}
+
+	err = clickAndWaitIdle(pg, btn)
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	return nil
+}
@@ -0,0 +1,35 @@
+package internal
+
+func init() {
+	pack, err := declarativeStatePack("ping",
+		&declarativeState{
+			StateName:     "Ping sign in error",
+			StateSelector: `.ping-error:not(:empty)`,
+			Action:        failAction,
+		},
+		&declarativeState{
+			StateName:     "Ping username input",
+			StateSelector: `input[name="pf.username"]:not([disabled])`,
+			Action:        fillUsernameAction,
+		},
+		&declarativeState{
+			StateName:     "Ping password input",
+			StateSelector: `input[name="pf.pass"]:not([disabled])`,
+			Action:        fillSecretAction,
+			Label:         "Ping Password",
+			Submit:        `#signOnButton`,
+		},
+		&declarativeState{
+			StateName:     "PingID passcode input",
+			StateSelector: `input#otp:not([disabled])`,
+			Action:        promptAndFillAction,
+			Label:         "PingID Passcode",
+			Submit:        `input[type=submit],button[type=submit]`,
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	registerLoginStates(pack.name, pack.errorStates, pack.states)
+}
@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/vahid-haghighat/awsure/cmd/types"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var pastePageTemplate = template.Must(template.New("paste").Parse(`<!DOCTYPE html>
+<html>
+<head><title>awsure</title></head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h2>awsure login</h2>
+<ol>
+<li>Open the developer tools of your browser, go to the network tab and enable preserving the log.</li>
+<li><a href="{{.LoginUrl}}" target="_blank">Sign in to Azure</a> in a new tab.</li>
+<li>Find the POST request to <code>https://signin.aws.amazon.com/saml</code> and copy the value of the <code>SAMLResponse</code> form field.</li>
+<li>Paste it below.</li>
+</ol>
+<form method="post" action="{{.SamlPath}}">
+<textarea name="SAMLResponse" rows="12" style="width: 100%"></textarea>
+<p><input type="submit" value="Continue"></p>
+</form>
+</body>
+</html>
+`))
+
+const samlReceivedPage = `<!DOCTYPE html>
+<html>
+<head><title>awsure</title></head>
+<body style="font-family: sans-serif; max-width: 48em; margin: 2em auto">
+<h2>awsure received the SAML response</h2>
+<p>You can close this window and return to the terminal.</p>
+</body>
+</html>
+`
+
+var loginStateMismatchError = errors.New("the SAML response isn't for this login")
+
+// loginSystemBrowser opens the login url in the default browser of the system,
+// so the user's own profile, passkeys and device compliance are used. When
+// loopback_url is configured, Azure posts the SAML response to a local listener,
+// which needs the url to be a reply url of the AWS app. Otherwise, a local page
+// asks the user to paste the SAML response.
+//
+// Any page open in the browser can post to the listener, so it only takes a
+// response for this login: the paste page is served under a random path, and
+// Azure returns a random relay state and the id of the request to the
+// loopback url along with the response.
+func loginSystemBrowser(ctx context.Context, config *configuration, options types.Configuration) (string, error) {
+	state, err := randomLoginState()
+	if err != nil {
+		return "", err
+	}
+
+	listenAddress := "127.0.0.1:0"
+	pagePath := "/" + state + "/"
+	samlPath := pagePath + "saml"
+	assertionConsumerServiceUrl := AwsSamlEndpoint
+	relayState := ""
+
+	if config.LoopbackUrl != "" {
+		loopbackUrl, err := url.Parse(config.LoopbackUrl)
+		if err != nil {
+			return "", fmt.Errorf("invalid loopback url %s: %v", config.LoopbackUrl, err)
+		}
+		if loopbackUrl.Port() == "" {
+			return "", fmt.Errorf("the loopback url %s must have a port", config.LoopbackUrl)
+		}
+
+		// Azure posts to the reply url as it is, so its path can't be random
+		listenAddress = net.JoinHostPort(loopbackUrl.Hostname(), loopbackUrl.Port())
+		samlPath = loopbackUrl.Path
+		if samlPath == "" {
+			samlPath = "/"
+		}
+		assertionConsumerServiceUrl = config.LoopbackUrl
+		relayState = state
+	}
+
+	loginUrl, requestId, err := createLoginUrl(config.AzureAppIdUri, config.AzureTenantId, assertionConsumerServiceUrl, relayState)
+	if err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return "", fmt.Errorf("failed to listen on %s: %v", listenAddress, err)
+	}
+
+	samlResponseChan := make(chan string, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(samlPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "the SAML response should be posted", http.StatusMethodNotAllowed)
+			return
+		}
+
+		samlResponse := strings.Join(strings.Fields(r.PostFormValue("SAMLResponse")), "")
+		if samlResponse == "" {
+			http.Error(w, "the request has no SAML response", http.StatusBadRequest)
+			return
+		}
+
+		if relayState != "" {
+			err := checkLoginState(samlResponse, r.PostFormValue("RelayState"), relayState, requestId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(samlReceivedPage))
+
+		select {
+		case samlResponseChan <- samlResponse:
+		default:
+		}
+	})
+
+	pageUrl := loginUrl
+	if config.LoopbackUrl == "" {
+		mux.HandleFunc(pagePath, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != pagePath {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = pastePageTemplate.Execute(w, map[string]string{
+				"LoginUrl": loginUrl,
+				"SamlPath": samlPath,
+			})
+		})
+		pageUrl = fmt.Sprintf("http://%s%s", listener.Addr().String(), pagePath)
+	}
+
+	server := &http.Server{Handler: mux}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("The local login server stopped: %v\n", err)
+		}
+	}()
+
+	fmt.Printf("Continue the login in your browser. If it doesn't open, go to:\n%s\n", pageUrl)
+	err = openInSystemBrowser(pageUrl)
+	if err != nil {
+		fmt.Printf("Couldn't open the browser: %v\n", err)
+	}
+
+	ctx, cancel := withLoginTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	select {
+	case samlResponse := <-samlResponseChan:
+		// Give the browser a moment to receive the response page
+		time.Sleep(500 * time.Millisecond)
+		return samlResponse, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// randomLoginState returns a value only this login knows, to tell its requests
+// to the local listener from those of other pages
+func randomLoginState() (string, error) {
+	state := make([]byte, 16)
+	_, err := rand.Read(state)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(state), nil
+}
+
+// checkLoginState checks that the SAML response posted to the loopback url
+// came back with the relay state of this login and is in response to its
+// request
+func checkLoginState(saml string, relayState string, wantRelayState string, requestId string) error {
+	if subtle.ConstantTimeCompare([]byte(relayState), []byte(wantRelayState)) != 1 {
+		return fmt.Errorf("%w: the relay state doesn't match", loginStateMismatchError)
+	}
+
+	response, err := decodeSamlResponse(saml)
+	if err != nil {
+		return err
+	}
+	if response.InResponseTo != requestId {
+		return fmt.Errorf("%w: it isn't in response to the login request", loginStateMismatchError)
+	}
+	return nil
+}
+
+func openInSystemBrowser(pageUrl string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", pageUrl)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", pageUrl)
+	default:
+		cmd = exec.Command("xdg-open", pageUrl)
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
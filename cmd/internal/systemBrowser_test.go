@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCheckLoginState(t *testing.T) {
+	response := func(inResponseTo string) string {
+		return base64.StdEncoding.EncodeToString([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_r" InResponseTo="` + inResponseTo + `"></samlp:Response>`))
+	}
+
+	tests := []struct {
+		name       string
+		saml       string
+		relayState string
+		wantErr    error
+	}{
+		{
+			name:       "response to this login",
+			saml:       response("id-request"),
+			relayState: "state",
+		},
+		{
+			name:       "missing relay state",
+			saml:       response("id-request"),
+			relayState: "",
+			wantErr:    loginStateMismatchError,
+		},
+		{
+			name:       "other relay state",
+			saml:       response("id-request"),
+			relayState: "other",
+			wantErr:    loginStateMismatchError,
+		},
+		{
+			name:       "response to another request",
+			saml:       response("id-other"),
+			relayState: "state",
+			wantErr:    loginStateMismatchError,
+		},
+		{
+			name:       "unsolicited response",
+			saml:       response(""),
+			relayState: "state",
+			wantErr:    loginStateMismatchError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLoginState(tt.saml, tt.relayState, "state", "id-request")
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRandomLoginState(t *testing.T) {
+	first, err := randomLoginState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := randomLoginState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != 32 || first == second {
+		t.Errorf("randomLoginState() = %q then %q, want two different 32 character states", first, second)
+	}
+}
@@ -1,32 +1,89 @@
 package internal
 
 import (
-	"context"
 	"crypto/sha512"
 	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"github.com/go-rod/rod"
-	"log"
+	"gopkg.in/yaml.v3"
 	"reflect"
 	"strings"
 	"time"
 )
 
-var configFileVersion = "1.0.0"
+var configFileVersion = "1.1.0"
 
 type configuration struct {
-	AzureTenantId        string `yaml:"azure_tenant_id"`
-	AzureAppIdUri        string `yaml:"azure_app_id_uri"`
-	AzureUsername        string `yaml:"azure_username"`
-	OktaUsername         string `yaml:"okta_username"`
-	RememberMe           bool   `yaml:"remember_me"`
-	DefaultJumpRole      string `yaml:"default_jump_role"`
-	DestinationAccountId string `yaml:"destination_account_id"`
-	DestinationRoleName  string `yaml:"destination_role_name"`
-	DefaultDurationHours int    `yaml:"default_duration_hours"`
-	Region               string `yaml:"region"`
+	// Identity and Defaults name the blocks of the config file the profile
+	// inherits from
+	Identity             string   `yaml:"identity,omitempty"`
+	Defaults             string   `yaml:"defaults,omitempty"`
+	Idp                  string   `yaml:"idp,omitempty"`
+	AzureTenantId        string   `yaml:"azure_tenant_id,omitempty"`
+	AzureAppIdUri        string   `yaml:"azure_app_id_uri,omitempty"`
+	AzureUsername        string   `yaml:"azure_username,omitempty"`
+	AzureClientId        string   `yaml:"azure_client_id,omitempty"`
+	AuthMode             string   `yaml:"auth_mode,omitempty"`
+	LoopbackUrl          string   `yaml:"loopback_url,omitempty"`
+	OktaAppUrl           string   `yaml:"okta_app_url,omitempty"`
+	OktaUsername         string   `yaml:"okta_username,omitempty"`
+	RememberMe           bool     `yaml:"remember_me,omitempty"`
+	DefaultJumpRole      string   `yaml:"default_jump_role,omitempty"`
+	DestinationAccountId string   `yaml:"destination_account_id,omitempty"`
+	DestinationRoleName  string   `yaml:"destination_role_name,omitempty"`
+	DefaultDurationHours int      `yaml:"default_duration_hours,omitempty"`
+	Region               string   `yaml:"region,omitempty"`
+	BrowserUrl           string   `yaml:"browser_url,omitempty"`
+	BrowserPath          string   `yaml:"browser_path,omitempty"`
+	BrowserArgs          []string `yaml:"browser_args,omitempty"`
+	BrowserNoSandbox     bool     `yaml:"browser_no_sandbox,omitempty"`
+	Proxy                string   `yaml:"proxy,omitempty"`
+	CaBundle             string   `yaml:"ca_bundle,omitempty"`
+	VerifySaml           bool     `yaml:"verify_saml,omitempty"`
+	SamlCertificate      string   `yaml:"saml_certificate,omitempty"`
+	SamlMetadataUrl      string   `yaml:"saml_metadata_url,omitempty"`
+
+	// explicit are the keys set to false or empty on purpose, which override
+	// the inherited values instead of being left out
+	explicit explicitKeys
+}
+
+// explicitKeys are the keys a block of the config file sets, by their yaml key
+type explicitKeys map[string]bool
+
+// UnmarshalYAML records the keys the profile sets, so false and empty values
+// override the inherited ones
+func (c *configuration) UnmarshalYAML(node *yaml.Node) error {
+	type plain configuration
+	err := node.Decode((*plain)(c))
+	if err != nil {
+		return err
+	}
+
+	c.explicit = nodeKeys(node)
+	return nil
+}
+
+// MarshalYAML keeps the false and empty values the profile sets on purpose,
+// which omitempty would leave out
+func (c configuration) MarshalYAML() (interface{}, error) {
+	type plain configuration
+	return withExplicitValues(plain(c), c.explicit)
+}
+
+// markExplicit records that the key is set on purpose, even when it's empty
+func (c *configuration) markExplicit(key string) {
+	if c.explicit == nil {
+		c.explicit = make(explicitKeys)
+	}
+	c.explicit[key] = true
+}
+
+// unmarkExplicit lets the key be inherited again when it's empty
+func (c *configuration) unmarkExplicit(key string) {
+	delete(c.explicit, key)
 }
 
 func (c *configuration) Hash() string {
@@ -35,6 +92,9 @@ func (c *configuration) Hash() string {
 		c.AzureAppIdUri,
 		c.AzureUsername,
 		c.OktaUsername)
+	if c.Idp == idpOkta {
+		input = fmt.Sprintf("%s|%s|%s", c.Idp, c.OktaAppUrl, c.OktaUsername)
+	}
 
 	hash := sha512.New()
 	hash.Write([]byte(input))
@@ -48,22 +108,35 @@ func (c *configuration) Merge(other *configuration) {
 	otherValue := reflect.ValueOf(other).Elem()
 
 	for i := 0; i < cValue.NumField(); i++ {
+		if !cValue.Type().Field(i).IsExported() {
+			continue
+		}
+
 		cField := cValue.Field(i)
 		otherField := otherValue.Field(i)
+		key := yamlKey(cValue.Type().Field(i))
+		explicit := other.explicit[key]
+		if explicit {
+			c.markExplicit(key)
+		}
 
 		switch cField.Kind() {
 		case reflect.String:
-			if otherField.String() != "" {
+			if otherField.String() != "" || explicit {
 				cField.SetString(otherField.String())
 			}
 		case reflect.Bool:
-			if otherField.Bool() {
+			if otherField.Bool() || explicit {
 				cField.SetBool(otherField.Bool())
 			}
 		case reflect.Int:
 			if otherField.Int() >= 1 && otherField.Int() <= 12 {
 				cField.SetInt(otherField.Int())
 			}
+		case reflect.Slice:
+			if otherField.Len() > 0 || explicit {
+				cField.Set(otherField)
+			}
 		case reflect.Invalid:
 		case reflect.Int8:
 		case reflect.Int16:
@@ -85,16 +158,215 @@ func (c *configuration) Merge(other *configuration) {
 		case reflect.Interface:
 		case reflect.Map:
 		case reflect.Pointer:
-		case reflect.Slice:
 		case reflect.Struct:
 		case reflect.UnsafePointer:
 		}
 	}
 }
 
+// identity is how a person logs in to an identity provider. Profiles that
+// log in the same way can share one
+type identity struct {
+	Idp           string `yaml:"idp,omitempty"`
+	AzureTenantId string `yaml:"azure_tenant_id,omitempty"`
+	AzureAppIdUri string `yaml:"azure_app_id_uri,omitempty"`
+	AzureUsername string `yaml:"azure_username,omitempty"`
+	AzureClientId string `yaml:"azure_client_id,omitempty"`
+	AuthMode      string `yaml:"auth_mode,omitempty"`
+	LoopbackUrl   string `yaml:"loopback_url,omitempty"`
+	OktaAppUrl    string `yaml:"okta_app_url,omitempty"`
+	OktaUsername  string `yaml:"okta_username,omitempty"`
+	RememberMe    bool   `yaml:"remember_me,omitempty"`
+
+	explicit explicitKeys
+}
+
+// UnmarshalYAML records the keys the identity sets, like the ones of profiles
+func (i *identity) UnmarshalYAML(node *yaml.Node) error {
+	type plain identity
+	err := node.Decode((*plain)(i))
+	if err != nil {
+		return err
+	}
+
+	i.explicit = nodeKeys(node)
+	return nil
+}
+
+func (i identity) MarshalYAML() (interface{}, error) {
+	type plain identity
+	return withExplicitValues(plain(i), i.explicit)
+}
+
+func (i *identity) configuration() *configuration {
+	return &configuration{
+		explicit:      i.explicit,
+		Idp:           i.Idp,
+		AzureTenantId: i.AzureTenantId,
+		AzureAppIdUri: i.AzureAppIdUri,
+		AzureUsername: i.AzureUsername,
+		AzureClientId: i.AzureClientId,
+		AuthMode:      i.AuthMode,
+		LoopbackUrl:   i.LoopbackUrl,
+		OktaAppUrl:    i.OktaAppUrl,
+		OktaUsername:  i.OktaUsername,
+		RememberMe:    i.RememberMe,
+	}
+}
+
+// Unresolve returns the values of the profile that differ from the inherited
+// ones, which is what's saved for a profile that inherits from blocks. Empty
+// values only stay when they're set on purpose over inherited ones
+func (c *configuration) Unresolve(inherited *configuration) *configuration {
+	raw := *c
+	raw.explicit = nil
+	rawValue := reflect.ValueOf(&raw).Elem()
+	inheritedValue := reflect.ValueOf(inherited).Elem()
+	rawType := rawValue.Type()
+
+	for i := 0; i < rawValue.NumField(); i++ {
+		field := rawType.Field(i)
+		if !field.IsExported() || field.Name == "Identity" || field.Name == "Defaults" {
+			continue
+		}
+
+		key := yamlKey(field)
+		if reflect.DeepEqual(rawValue.Field(i).Interface(), inheritedValue.Field(i).Interface()) {
+			rawValue.Field(i).Set(reflect.Zero(rawValue.Field(i).Type()))
+		} else if isEmptyValue(rawValue.Field(i)) && c.explicit[key] {
+			raw.markExplicit(key)
+		}
+	}
+
+	return &raw
+}
+
+// applyChanges sets the values that differ between before and after on the
+// profile, so the values it inherits and that weren't changed stay inherited
+// instead of being copied into it
+func (c *configuration) applyChanges(before *configuration, after *configuration) {
+	value := reflect.ValueOf(c).Elem()
+	beforeValue := reflect.ValueOf(before).Elem()
+	afterValue := reflect.ValueOf(after).Elem()
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if reflect.DeepEqual(beforeValue.Field(i).Interface(), afterValue.Field(i).Interface()) {
+			continue
+		}
+
+		value.Field(i).Set(afterValue.Field(i))
+		if isEmptyValue(afterValue.Field(i)) {
+			c.markExplicit(yamlKey(field))
+		}
+	}
+}
+
+// nodeKeys returns the keys of a mapping node
+func nodeKeys(node *yaml.Node) explicitKeys {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	keys := make(explicitKeys)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keys[node.Content[i].Value] = true
+	}
+	return keys
+}
+
+// withExplicitValues encodes the struct and adds the false and empty values of
+// the explicit keys, which omitempty leaves out, in the order of the fields
+func withExplicitValues(value interface{}, explicit explicitKeys) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	err := node.Encode(value)
+	if err != nil || len(explicit) == 0 {
+		return node, err
+	}
+
+	encoded := make(map[string][]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		encoded[node.Content[i].Value] = node.Content[i : i+2]
+	}
+
+	structValue := reflect.ValueOf(value)
+	var content []*yaml.Node
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := yamlKey(field)
+		if pair, ok := encoded[key]; ok {
+			content = append(content, pair...)
+			continue
+		}
+
+		// An explicit 0 isn't a value any int key accepts
+		if !explicit[key] || field.Type.Kind() == reflect.Int {
+			continue
+		}
+
+		valueNode := &yaml.Node{}
+		err = valueNode.Encode(structValue.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+	}
+	node.Content = content
+	node.Style = 0
+
+	return node, nil
+}
+
+// isEmptyValue reports if omitempty leaves the value out
+func isEmptyValue(value reflect.Value) bool {
+	if value.Kind() == reflect.Slice {
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func yamlKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
 type configurationFile struct {
-	Version string                    `yaml:"version"`
-	Configs map[string]*configuration `yaml:"configs"`
+	Version        string                    `yaml:"version"`
+	Identities     map[string]*identity      `yaml:"identities,omitempty"`
+	Defaults       map[string]*configuration `yaml:"defaults,omitempty"`
+	Configs        map[string]*configuration `yaml:"configs"`
+	AccountAliases map[string]string         `yaml:"account_aliases,omitempty"`
+}
+
+// accountAliasesFile caches the account names found by `awsure accounts sync`
+type accountAliasesFile struct {
+	Version  string            `yaml:"version"`
+	SyncedAt time.Time         `yaml:"synced_at"`
+	Aliases  map[string]string `yaml:"aliases"`
+}
+
+// browserSettings is how the browser is launched and how awsure reaches the
+// identity provider, from the configuration and the command line flags
+type browserSettings struct {
+	url       string
+	path      string
+	args      []string
+	noSandbox bool
+	proxy     string
+	caBundle  string
+}
+
+// cachedRolesFile keeps the roles of the last login of each identity, so the
+// config wizard can offer them
+type cachedRolesFile struct {
+	Version string              `yaml:"version"`
+	Roles   map[string][]string `yaml:"roles"`
 }
 
 type jumpRoleCredentials struct {
@@ -102,6 +374,7 @@ type jumpRoleCredentials struct {
 	AwsSecretAccessKey string    `yaml:"aws_secret_access_key"`
 	AwsSessionToken    string    `yaml:"aws_session_token"`
 	AwsExpiration      time.Time `yaml:"aws_expiration"`
+	RoleSessionName    string    `yaml:"role_session_name,omitempty"`
 }
 
 type jumpRoleCredentialsFile struct {
@@ -109,26 +382,93 @@ type jumpRoleCredentialsFile struct {
 	Credentials map[string]*jumpRoleCredentials `yaml:"credentials"`
 }
 
+// LoginState is a page of an identity provider's login flow. The login loop
+// looks for Selector on the current page and calls Handle when it's found
+type LoginState interface {
+	Name() string
+	Selector() string
+	Handle(pg *rod.Page, el *rod.Element, conf *configuration) error
+}
+
+type loginStatePack struct {
+	name        string
+	errorStates []LoginState
+	states      []LoginState
+}
+
 type state struct {
 	name     string
 	selector string
 	handler  func(pg *rod.Page, el *rod.Element, conf *configuration) error
 }
 
+type declarativeState struct {
+	StateName     string `yaml:"name"`
+	StateSelector string `yaml:"selector"`
+	Action        string `yaml:"action"`
+	Label         string `yaml:"label"`
+	Username      string `yaml:"username"`
+	Submit        string `yaml:"submit"`
+
+	printedText string
+}
+
+type declarativeStatesFile struct {
+	Version string              `yaml:"version"`
+	States  []*declarativeState `yaml:"states"`
+}
+
 type samlResponse struct {
-	XMLName   xml.Name
-	Assertion samlAssertion `xml:"Assertion"`
+	XMLName      xml.Name
+	Destination  string        `xml:"Destination,attr"`
+	InResponseTo string        `xml:"InResponseTo,attr"`
+	IssueInstant string        `xml:"IssueInstant,attr"`
+	Issuer       string        `xml:"Issuer"`
+	Signature    samlSignature `xml:"Signature"`
+	Assertion    samlAssertion `xml:"Assertion"`
+	// EncryptedAssertion is only checked for presence, as awsure has no key to
+	// decrypt it
+	EncryptedAssertion *struct{} `xml:"EncryptedAssertion"`
 }
 
 type samlAssertion struct {
 	XMLName            xml.Name
+	Issuer             string        `xml:"Issuer"`
+	Signature          samlSignature `xml:"Signature"`
+	Subject            samlSubject
+	Conditions         samlConditions
 	AttributeStatement samlAttributeStatement
 }
 
+type samlSignature struct {
+	Certificate string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
+
+type samlNameId struct {
+	Format string `xml:"Format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type samlSubjectConfirmationData struct {
+	NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+	Recipient    string `xml:"Recipient,attr"`
+}
+
+type samlSubject struct {
+	NameId                  samlNameId                  `xml:"NameID"`
+	SubjectConfirmationData samlSubjectConfirmationData `xml:"SubjectConfirmation>SubjectConfirmationData"`
+}
+
+type samlConditions struct {
+	NotBefore    string   `xml:"NotBefore,attr"`
+	NotOnOrAfter string   `xml:"NotOnOrAfter,attr"`
+	Audiences    []string `xml:"AudienceRestriction>Audience"`
+}
+
 type samlAttributeValue struct {
 	XMLName xml.Name
 	Type    string `xml:"xsi:type,attr"`
-	Value   string `xml:",innerxml"`
+	Value   string `xml:",chardata"`
 }
 
 type samlAttribute struct {
@@ -142,398 +482,161 @@ type samlAttributeStatement struct {
 	Attributes []samlAttribute `xml:"Attribute"`
 }
 
-type role struct {
-	roleArn      string
-	principalArn string
+type samlDecodedAttribute struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
 }
 
-var states = []state{
-	{
-		name:     "username input",
-		selector: `input[name="loginfmt"]:not(.moveOffScreen)`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			var err error
-			username := conf.AzureUsername
-			if username == "" {
-				prompter := Prompter{}
-				username, err = prompter.Prompt("Azure Username", username)
-				if err != nil {
-					return err
-				}
-			}
+type samlDecodedCertificate struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	Sha1Fingerprint   string    `json:"sha1_fingerprint"`
+	Sha256Fingerprint string    `json:"sha256_fingerprint"`
+}
 
-			el.MustWaitVisible()
-			el.MustSelectAllText().MustInput("")
-			el.MustInput(strings.TrimSpace(username))
-
-			sb := pg.MustElement(`input[type=submit]`)
-
-			sb.MustWaitVisible()
-			wait := pg.MustWaitRequestIdle()
-			sb.MustClick()
-			wait()
-
-			pContext := pg.GetContext()
-			defer func() {
-				pg.Context(pContext)
-			}()
-
-			ctx, cancel := context.WithCancel(pContext)
-			defer cancel()
-
-			ch := make(chan bool, 1)
-
-			go func() {
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						_, err := pg.Sleeper(rod.NotFoundSleeper).Element("input[name=loginfmt]")
-						if err != nil {
-							ch <- true
-							return
-						}
-					}
-				}
-			}()
-
-			go func() {
-				_, err := pg.Timeout(20 * time.Second).Race().
-					Element("input[name=loginfmt].has-error").
-					Element("input[name=loginfmt].moveOffScreen").
-					Element("input[name=loginfmt]").Handle(func(e *rod.Element) error {
-					return e.WaitInvisible()
-				}).Do()
-				if err != nil {
-					return
-				}
-
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					ch <- true
-					return
-				}
-			}()
-
-			select {
-			case <-ch:
-			case <-time.After(25 * time.Second):
-			}
-			return nil
-		},
-	},
-	{
-		name:     "password input",
-		selector: `input[name="Password"]:not(.moveOffScreen),input[name="passwd"]:not(.moveOffScreen)`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".alert-error")
-
-			if alert != nil && err == nil {
-				log.Println(alert.Text())
-			}
+// samlDecoded is what `awsure saml decode` shows of a SAML response
+type samlDecoded struct {
+	Issuer          string                  `json:"issuer"`
+	Destination     string                  `json:"destination,omitempty"`
+	Recipient       string                  `json:"recipient,omitempty"`
+	Encrypted       bool                    `json:"encrypted"`
+	Subject         string                  `json:"subject"`
+	SubjectFormat   string                  `json:"subject_format,omitempty"`
+	NotBefore       string                  `json:"not_before,omitempty"`
+	NotOnOrAfter    string                  `json:"not_on_or_after,omitempty"`
+	Audiences       []string                `json:"audiences"`
+	SessionDuration string                  `json:"session_duration,omitempty"`
+	RoleSessionName string                  `json:"role_session_name,omitempty"`
+	Attributes      []samlDecodedAttribute  `json:"attributes"`
+	Certificate     *samlDecodedCertificate `json:"certificate,omitempty"`
+}
 
-			prompter := Prompter{}
-			password, err := prompter.SensitivePrompt("Azure Password")
-
-			el.MustWaitVisible()
-			el.MustSelectAllText().MustInput("")
-			el.MustInput(password)
-
-			wait := pg.MustWaitRequestIdle()
-			pg.MustElement("span[class=submit],input[type=submit]").MustClick()
-			wait()
-
-			time.Sleep(time.Millisecond * 500)
-			return nil
-		},
-	},
-	{
-		name:     "OKTA username input",
-		selector: `form:not(.o-form-saving) > div span.okta-form-input-field input[name="identifier"]:not([disabled])`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			errorSelector := `div.o-form-error-container`
-			errorContainer, err := pg.Sleeper(rod.NotFoundSleeper).Element(errorSelector)
-
-			if errorContainer != nil && err == nil {
-				t, _ := errorContainer.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+type samlMetadataKeyDescriptor struct {
+	Use         string `xml:"use,attr"`
+	Certificate string `xml:"KeyInfo>X509Data>X509Certificate"`
+}
 
-			infoSelector := `div.o-form-info-container`
-			infoContainer, err := pg.Sleeper(rod.NotFoundSleeper).Element(infoSelector)
-			if infoContainer != nil && err == nil {
-				t, _ := infoContainer.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+type samlMetadataIdpDescriptor struct {
+	KeyDescriptors []samlMetadataKeyDescriptor `xml:"KeyDescriptor"`
+}
 
-			username := conf.OktaUsername
-			if username == "" {
-				prompter := Prompter{}
-				username, err = prompter.Prompt("Okta Username", username)
-				if err != nil {
-					return err
-				}
-			}
+// samlMetadataDocument is the part of the federation metadata of an identity
+// provider that has its signing certificates
+type samlMetadataDocument struct {
+	XMLName        xml.Name                    `xml:"EntityDescriptor"`
+	IdpDescriptors []samlMetadataIdpDescriptor `xml:"IDPSSODescriptor"`
+}
 
-			el.MustWaitVisible()
-			el.MustSelectAllText().MustInput("")
-			el.MustInput(username)
-
-			time.Sleep(time.Millisecond * 500)
-
-			submitSelector := `input:not([disabled]):not(.link-button-disabled):not(.btn-disabled)[type=submit]`
-
-			btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(submitSelector)
-			if err == nil {
-				wait := pg.MustWaitRequestIdle()
-				btn.MustClick()
-				wait()
-
-				pContext := pg.GetContext()
-				defer func() {
-					pg.Context(pContext)
-				}()
-
-				ctx, cancel := context.WithCancel(pContext)
-				defer cancel()
-
-				ch := make(chan bool, 1)
-
-				go func() {
-					for {
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							_, err := pg.Sleeper(rod.NotFoundSleeper).Element(submitSelector)
-							if err != nil {
-								ch <- true
-								return
-							}
-						}
-					}
-				}()
-
-				go func() {
-					_, err := pg.Timeout(20 * time.Second).Race().
-						Element(errorSelector + `.o-form-has-errors`).Handle(func(e *rod.Element) error {
-						if e != nil {
-							t, _ := e.Text()
-							if t != "" {
-								return errors.New("error returned")
-							}
-						}
-						return nil
-					}).
-						Element(submitSelector).Handle(func(e *rod.Element) error {
-						return e.WaitInvisible()
-					}).Do()
-					if err != nil {
-						return
-					}
-
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						ch <- true
-						return
-					}
-				}()
-
-				select {
-				case <-ch:
-				case <-time.After(25 * time.Second):
-				}
-			}
-			return nil
-		},
-	},
-	{
-		name:     "OKTA password input",
-		selector: `div.challenge-authenticator--okta_password.mfa-verify-password input[type="password"]:not([disabled])`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			errorSelector := `div.o-form-error-container`
-			errorContainer, err := pg.Sleeper(rod.NotFoundSleeper).Element(errorSelector)
-
-			if errorContainer != nil && err == nil {
-				t, _ := errorContainer.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+type samlResult struct {
+	saml string
+	err  error
+}
 
-			infoSelector := `div.o-form-info-container`
-			infoContainer, err := pg.Sleeper(rod.NotFoundSleeper).Element(infoSelector)
-			if infoContainer != nil && err == nil {
-				t, _ := infoContainer.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+type role struct {
+	roleArn      string
+	principalArn string
+}
 
-			el.MustVisible()
+type oktaLink struct {
+	Href string `json:"href"`
+}
 
-			prompter := Prompter{}
-			password, err := prompter.SensitivePrompt("Okta Password")
-			if err != nil {
-				return err
-			}
+type oktaFactor struct {
+	Id         string `json:"id"`
+	FactorType string `json:"factorType"`
+	Provider   string `json:"provider"`
+	Links      struct {
+		Verify oktaLink `json:"verify"`
+	} `json:"_links"`
+	Embedded struct {
+		Challenge struct {
+			CorrectAnswer int `json:"correctAnswer"`
+		} `json:"challenge"`
+	} `json:"_embedded"`
+}
 
-			el.MustInput(password)
-
-			time.Sleep(time.Millisecond * 500)
-
-			submitSelector := `input:not([disabled]):not(.link-button-disabled):not(.btn-disabled)[type=submit]`
-
-			btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(submitSelector)
-			if err == nil {
-				wait := pg.MustWaitRequestIdle()
-				btn.MustClick()
-				wait()
-
-				pContext := pg.GetContext()
-				defer func() {
-					pg.Context(pContext)
-				}()
-
-				ctx, cancel := context.WithCancel(pContext)
-				defer cancel()
-
-				ch := make(chan bool, 1)
-
-				go func() {
-					for {
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							_, err := pg.Sleeper(rod.NotFoundSleeper).Element(submitSelector)
-							if err != nil {
-								ch <- true
-								return
-							}
-						}
-					}
-				}()
-
-				go func() {
-					_, err := pg.Timeout(20 * time.Second).Race().
-						Element(errorSelector + `.o-form-has-errors`).Handle(func(e *rod.Element) error {
-						if e != nil {
-							t, _ := e.Text()
-							if t != "" {
-								return errors.New("error returned")
-							}
-						}
-						return nil
-					}).
-						Element(submitSelector).Handle(func(e *rod.Element) error {
-						return e.WaitInvisible()
-					}).Do()
-					if err != nil {
-						return
-					}
-
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						ch <- true
-						return
-					}
-				}()
-
-				select {
-				case <-ch:
-				case <-time.After(25 * time.Second):
-				}
-			}
-			return nil
-		},
-	},
-	{
-		name:     "OKTA SELECT PUSH Form",
-		selector: `div[data-se="okta_verify-push"] > a:not([disabled]):not(.link-button-disabled):not(.btn-disabled)`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".infobox-error")
-
-			if alert != nil && err == nil {
-				t, _ := alert.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+type oktaAuthnResponse struct {
+	StateToken   string `json:"stateToken"`
+	SessionToken string `json:"sessionToken"`
+	Status       string `json:"status"`
+	FactorResult string `json:"factorResult"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorSummary string `json:"errorSummary"`
+	Embedded     struct {
+		Factors []oktaFactor `json:"factors"`
+		Factor  oktaFactor   `json:"factor"`
+	} `json:"_embedded"`
+	Links struct {
+		Next oktaLink `json:"next"`
+	} `json:"_links"`
+}
 
-			btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(`div[data-se="okta_verify-push"] > a:not([disabled]):not(.btn-disabled):not(.link-button-disabled)`)
-			if err == nil && btn != nil {
-				btn.MustWaitVisible()
-				wait := pg.MustWaitRequestIdle()
-				btn.MustClick()
-				wait()
-				time.Sleep(time.Millisecond * 500)
-			}
-			return nil
-		},
-	},
-	{
-		name:     "OKTA DO PUSH Form",
-		selector: `a.send-push:not([disabled]):not(.link-button-disabled):not(.btn-disabled)`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".infobox-error")
-
-			if alert != nil && err == nil {
-				t, _ := alert.Text()
-				if t != "" {
-					fmt.Println(t)
-				}
-			}
+// oktaIdxResponse is the state of a login through the IDX api of the Okta
+// Identity Engine. Its remediations are the steps the login can take next
+type oktaIdxResponse struct {
+	StateHandle string `json:"stateHandle"`
+	Remediation struct {
+		Value []oktaIdxRemediation `json:"value"`
+	} `json:"remediation"`
+	CurrentAuthenticator struct {
+		Value oktaIdxAuthenticator `json:"value"`
+	} `json:"currentAuthenticator"`
+	Messages struct {
+		Value []oktaIdxMessage `json:"value"`
+	} `json:"messages"`
+	Success *oktaLink `json:"success"`
+}
 
-			btn, err := pg.Sleeper(rod.NotFoundSleeper).Element(`a.send-push:not([disabled]):not(.btn-disabled):not(.link-button-disabled)`)
-			if err == nil && btn != nil {
-				btn.MustWaitVisible()
-				wait := pg.MustWaitRequestIdle()
-				btn.MustClick()
-				wait()
-				time.Sleep(time.Millisecond * 500)
-			}
-			return nil
-		},
-	},
-	{
-		name:     "MFA input",
-		selector: `div.challenge-authenticator--google_otp.mfa-verify`,
-		handler: func(pg *rod.Page, el *rod.Element, conf *configuration) error {
-			alert, err := pg.Sleeper(rod.NotFoundSleeper).Element(".alert-error")
-
-			if alert != nil && err == nil {
-				log.Println(alert.Text())
-			}
+type oktaIdxRemediation struct {
+	Name    string         `json:"name"`
+	Href    string         `json:"href"`
+	Refresh int            `json:"refresh"`
+	Value   []oktaIdxField `json:"value"`
+}
 
-			prompter := Prompter{}
-			mfa, err := prompter.Prompt("Google Authenticator Code", "")
-			if err != nil {
-				return err
-			}
+type oktaIdxField struct {
+	Name    string          `json:"name"`
+	Value   json.RawMessage `json:"value"`
+	Options []oktaIdxOption `json:"options"`
+	Form    struct {
+		Value []oktaIdxField `json:"value"`
+	} `json:"form"`
+}
+
+type oktaIdxOption struct {
+	Label string          `json:"label"`
+	Value json.RawMessage `json:"value"`
+}
 
-			el = el.MustElement(`input[name='credentials.passcode']`)
-			el.MustWaitVisible()
-			el.MustSelectAllText().MustInput("")
-			el.MustInput(mfa)
+type oktaIdxAuthenticator struct {
+	Type           string `json:"type"`
+	Key            string `json:"key"`
+	DisplayName    string `json:"displayName"`
+	ContextualData struct {
+		CorrectAnswer int `json:"correctAnswer"`
+	} `json:"contextualData"`
+}
+
+type oktaIdxMessage struct {
+	Message string `json:"message"`
+	Class   string `json:"class"`
+}
 
-			wait := pg.MustWaitRequestIdle()
-			pg.MustElement("input[type=submit]").MustClick()
-			wait()
+type azureDeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationUri string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Message         string `json:"message"`
+}
 
-			time.Sleep(time.Millisecond * 500)
-			return nil
-		},
-	},
+type azureTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IssuedTokenType  string `json:"issued_token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
 }
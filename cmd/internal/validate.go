@@ -0,0 +1,506 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	"gopkg.in/yaml.v3"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	problemError   = "error"
+	problemWarning = "warning"
+)
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+var domainPattern = regexp.MustCompile(`^([a-zA-Z0-9-]+\.)+[a-zA-Z]{2,}$`)
+var accountIdPattern = regexp.MustCompile(`^\d{12}$`)
+var roleNamePattern = regexp.MustCompile(`^([\w+=,.@-]+/)*[\w+=,.@-]{1,64}$`)
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]*)?-[a-z]+-\d+$`)
+
+var awsRegions = []string{
+	"af-south-1",
+	"ap-east-1", "ap-east-2", "ap-northeast-1", "ap-northeast-2", "ap-northeast-3",
+	"ap-south-1", "ap-south-2", "ap-southeast-1", "ap-southeast-2", "ap-southeast-3",
+	"ap-southeast-4", "ap-southeast-5", "ap-southeast-6", "ap-southeast-7",
+	"ca-central-1", "ca-west-1",
+	"cn-north-1", "cn-northwest-1",
+	"eu-central-1", "eu-central-2", "eu-north-1", "eu-south-1", "eu-south-2",
+	"eu-west-1", "eu-west-2", "eu-west-3",
+	"il-central-1",
+	"me-central-1", "me-south-1",
+	"mx-central-1",
+	"sa-east-1",
+	"us-east-1", "us-east-2", "us-gov-east-1", "us-gov-west-1", "us-west-1", "us-west-2",
+}
+
+// configProblem is something wrong in the config file, at a line of it
+type configProblem struct {
+	line     int
+	path     string
+	severity string
+	message  string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("line %d: %s: %s: %s", p.line, p.severity, p.path, p.message)
+}
+
+// configValueValidators check the values of the settings, by their key
+var configValueValidators = map[string]func(node *yaml.Node) (string, string){
+	"idp":                    oneOfValidator("", idpAzure, idpOkta),
+	"azure_tenant_id":        validateTenantId,
+	"azure_client_id":        validateGuid,
+	"auth_mode":              oneOfValidator("", authModeBrowser, authModeDeviceCode, authModeSystemBrowser),
+	"loopback_url":           validateLoopbackUrl,
+	"okta_app_url":           validateHttpsUrl,
+	"remember_me":            validateBool,
+	"default_jump_role":      validateRoleArn,
+	"destination_account_id": validateAccountId,
+	"destination_role_name":  validateRoleName,
+	"default_duration_hours": validateDuration,
+	"region":                 validateRegion,
+	"browser_url":            validateUrl,
+	"browser_args":           validateStrings,
+	"browser_no_sandbox":     validateBool,
+	"proxy":                  validateUrl,
+	"verify_saml":            validateBool,
+	"saml_metadata_url":      validateHttpsUrl,
+}
+
+var reportedConfigProblems sync.Map
+
+// ValidateConfig checks the config file at path and prints what's wrong with
+// it. It fails when the file has errors
+func ValidateConfig(path string) error {
+	if path == "" {
+		path = defaultConfigLocation
+	}
+
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s doesn't exist", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	document := yaml.Node{}
+	err = yaml.Unmarshal(content, &document)
+	if err != nil {
+		return fmt.Errorf("%s isn't valid YAML: %v", path, err)
+	}
+
+	if len(document.Content) == 0 {
+		fmt.Printf("%s is empty\n", path)
+		return nil
+	}
+	root := document.Content[0]
+
+	err = migrateConfigFile(path, root)
+	if err != nil {
+		return err
+	}
+
+	problems := validateConfigNode(root)
+	if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	}
+
+	errorCount := 0
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if problem.severity == problemError {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("%s has %d errors", path, errorCount)
+	}
+	return nil
+}
+
+// reportConfigProblems prints the problems of the config file once, so every
+// command that loads it points at what's wrong without stopping
+func reportConfigProblems(path string, root *yaml.Node) {
+	if _, reported := reportedConfigProblems.LoadOrStore(path, true); reported {
+		return
+	}
+
+	problems := validateConfigNode(root)
+	if len(problems) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "%s has problems. Run 'awsure config validate' for details\n", path)
+	for _, problem := range problems {
+		_, _ = fmt.Fprintf(os.Stderr, "  %s\n", problem)
+	}
+}
+
+func validateConfigNode(root *yaml.Node) []configProblem {
+	var problems []configProblem
+
+	if root.Kind != yaml.MappingNode {
+		return []configProblem{{line: root.Line, path: "config", severity: problemError, message: "the config file should be a mapping"}}
+	}
+
+	problems = append(problems, unknownKeyProblems(root, "", yamlKeys(reflect.TypeOf(configurationFile{})))...)
+
+	configurationKeys := yamlKeys(reflect.TypeOf(configuration{}))
+	identityKeys := yamlKeys(reflect.TypeOf(identity{}))
+
+	identities := mappingValue(root, "identities")
+	defaults := mappingValue(root, "defaults")
+	// Profiles can name defaults even when the file has none, which the nil
+	// defaults of the blocks themselves would take as inheriting from defaults
+	profileDefaults := defaults
+	if profileDefaults == nil {
+		profileDefaults = &yaml.Node{Kind: yaml.MappingNode}
+	}
+
+	forEachMappingEntry(identities, "identities", &problems, func(name string, node *yaml.Node) {
+		path := "identities." + name
+		problems = append(problems, unknownKeyProblems(node, path, identityKeys)...)
+		problems = append(problems, valueProblems(node, path)...)
+	})
+
+	forEachMappingEntry(defaults, "defaults", &problems, func(name string, node *yaml.Node) {
+		path := "defaults." + name
+		problems = append(problems, unknownKeyProblems(node, path, configurationKeys)...)
+		problems = append(problems, valueProblems(node, path)...)
+		problems = append(problems, referenceProblems(node, path, identities, nil)...)
+	})
+
+	forEachMappingEntry(mappingValue(root, "configs"), "configs", &problems, func(name string, node *yaml.Node) {
+		path := "configs." + name
+		problems = append(problems, unknownKeyProblems(node, path, configurationKeys)...)
+		problems = append(problems, valueProblems(node, path)...)
+		problems = append(problems, referenceProblems(node, path, identities, profileDefaults)...)
+	})
+
+	forEachMappingEntry(mappingValue(root, "account_aliases"), "account_aliases", &problems, func(name string, node *yaml.Node) {
+		if !accountIdPattern.MatchString(name) {
+			problems = append(problems, configProblem{line: node.Line, path: "account_aliases." + name, severity: problemError, message: "the account id should be 12 digits"})
+		}
+	})
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].line < problems[j].line
+	})
+	return problems
+}
+
+func forEachMappingEntry(node *yaml.Node, path string, problems *[]configProblem, f func(name string, node *yaml.Node)) {
+	if node == nil {
+		return
+	}
+
+	if node.Kind != yaml.MappingNode {
+		if node.ShortTag() != "!!null" {
+			*problems = append(*problems, configProblem{line: node.Line, path: path, severity: problemError, message: "should be a mapping"})
+		}
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := node.Content[i+1]
+		if value.Kind != yaml.MappingNode && path != "account_aliases" {
+			if value.ShortTag() != "!!null" {
+				*problems = append(*problems, configProblem{line: value.Line, path: path + "." + node.Content[i].Value, severity: problemError, message: "should be a mapping"})
+			}
+			continue
+		}
+		f(node.Content[i].Value, value)
+	}
+}
+
+func unknownKeyProblems(node *yaml.Node, path string, known []string) []configProblem {
+	var problems []configProblem
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if contains(known, key.Value) {
+			continue
+		}
+
+		message := fmt.Sprintf("unknown key %s", key.Value)
+		if suggestion := closestKey(key.Value, known); suggestion != "" {
+			message = fmt.Sprintf("%s. did you mean %s?", message, suggestion)
+		}
+		problems = append(problems, configProblem{line: key.Line, path: joinConfigPath(path, key.Value), severity: problemWarning, message: message})
+	}
+
+	return problems
+}
+
+func valueProblems(node *yaml.Node, path string) []configProblem {
+	var problems []configProblem
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value := node.Content[i+1]
+
+		validator, ok := configValueValidators[key]
+		if !ok {
+			if value.Kind != yaml.ScalarNode {
+				problems = append(problems, configProblem{line: value.Line, path: joinConfigPath(path, key), severity: problemError, message: "should be a single value"})
+			}
+			continue
+		}
+
+		if severity, message := validator(value); message != "" {
+			problems = append(problems, configProblem{line: value.Line, path: joinConfigPath(path, key), severity: severity, message: message})
+		}
+	}
+
+	return problems
+}
+
+func referenceProblems(node *yaml.Node, path string, identities *yaml.Node, defaults *yaml.Node) []configProblem {
+	var problems []configProblem
+
+	if identityName := mappingValue(node, "identity"); identityName != nil && identityName.Value != "" && mappingValue(identities, identityName.Value) == nil {
+		problems = append(problems, configProblem{line: identityName.Line, path: path + ".identity", severity: problemError, message: fmt.Sprintf("the identity %s doesn't exist", identityName.Value)})
+	}
+
+	if defaults == nil {
+		if defaultsName := mappingValue(node, "defaults"); defaultsName != nil {
+			problems = append(problems, configProblem{line: defaultsName.Line, path: path + ".defaults", severity: problemError, message: "defaults can't inherit from other defaults"})
+		}
+	} else if defaultsName := mappingValue(node, "defaults"); defaultsName != nil && defaultsName.Value != "" && mappingValue(defaults, defaultsName.Value) == nil {
+		problems = append(problems, configProblem{line: defaultsName.Line, path: path + ".defaults", severity: problemError, message: fmt.Sprintf("the defaults %s don't exist", defaultsName.Value)})
+	}
+
+	return problems
+}
+
+func joinConfigPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// yamlKeys returns the yaml keys of the fields of a struct type
+func yamlKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+func closestKey(key string, known []string) string {
+	closest := ""
+	closestDistance := 4
+	for _, k := range known {
+		distance := fuzzy.LevenshteinDistance(key, k)
+		if distance < closestDistance {
+			closest = k
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+func scalarValue(node *yaml.Node) (string, string) {
+	if node.Kind != yaml.ScalarNode {
+		return "", "should be a single value"
+	}
+	return node.Value, ""
+}
+
+func oneOfValidator(values ...string) func(node *yaml.Node) (string, string) {
+	return func(node *yaml.Node) (string, string) {
+		value, message := scalarValue(node)
+		if message != "" {
+			return problemError, message
+		}
+		if !contains(values, value) {
+			return problemError, fmt.Sprintf("%s isn't one of %s", value, strings.Join(values[1:], ", "))
+		}
+		return "", ""
+	}
+}
+
+func validateTenantId(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value != "" && !guidPattern.MatchString(value) {
+		if domainPattern.MatchString(value) {
+			return problemWarning, "the tenant id is a domain. the GUID of the tenant is more reliable"
+		}
+		return problemError, fmt.Sprintf("%s isn't a GUID", value)
+	}
+	return "", ""
+}
+
+func validateGuid(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value != "" && !guidPattern.MatchString(value) {
+		return problemError, fmt.Sprintf("%s isn't a GUID", value)
+	}
+	return "", ""
+}
+
+func validateAccountId(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value == "" {
+		return "", ""
+	}
+	if !accountIdPattern.MatchString(value) {
+		return problemError, fmt.Sprintf("%s isn't 12 digits", value)
+	}
+	if node.ShortTag() != "!!str" {
+		return problemWarning, "quote the account id, so it's read as text"
+	}
+	return "", ""
+}
+
+func validateRoleName(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value == "" {
+		return "", ""
+	}
+	if strings.HasPrefix(value, "arn:") {
+		return problemError, "should be the name of the role, not its ARN"
+	}
+	if !roleNamePattern.MatchString(value) {
+		return problemError, fmt.Sprintf("%s isn't a valid role name", value)
+	}
+	return "", ""
+}
+
+func validateRoleArn(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value != "" && !roleArnPattern.MatchString(value) {
+		return problemError, fmt.Sprintf("%s isn't a valid role ARN", value)
+	}
+	return "", ""
+}
+
+func validateDuration(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil {
+		return problemError, fmt.Sprintf("%s isn't a number of hours", value)
+	}
+	if hours < 1 || hours > 12 {
+		return problemError, fmt.Sprintf("%d should be between 1 and 12 hours", hours)
+	}
+	return "", ""
+}
+
+func validateRegion(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value == "" {
+		return "", ""
+	}
+	if !regionPattern.MatchString(value) {
+		return problemError, fmt.Sprintf("%s isn't a valid region", value)
+	}
+	if !contains(awsRegions, value) {
+		return problemWarning, fmt.Sprintf("%s isn't a known region", value)
+	}
+	return "", ""
+}
+
+func validateUrl(node *yaml.Node) (string, string) {
+	value, message := scalarValue(node)
+	if message != "" {
+		return problemError, message
+	}
+	if value == "" {
+		return "", ""
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return problemError, fmt.Sprintf("%s isn't a valid url", value)
+	}
+	return "", ""
+}
+
+func validateHttpsUrl(node *yaml.Node) (string, string) {
+	severity, message := validateUrl(node)
+	if message != "" {
+		return severity, message
+	}
+	if node.Value != "" && !strings.HasPrefix(node.Value, "https://") {
+		return problemError, fmt.Sprintf("%s should be an https url", node.Value)
+	}
+	return "", ""
+}
+
+func validateLoopbackUrl(node *yaml.Node) (string, string) {
+	severity, message := validateUrl(node)
+	if message != "" {
+		return severity, message
+	}
+	if node.Value == "" {
+		return "", ""
+	}
+	parsed, _ := url.Parse(node.Value)
+	if parsed.Port() == "" {
+		return problemError, fmt.Sprintf("%s should have a port", node.Value)
+	}
+	return "", ""
+}
+
+func validateBool(node *yaml.Node) (string, string) {
+	if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+		return problemError, fmt.Sprintf("%s should be true or false", node.Value)
+	}
+	return "", ""
+}
+
+func validateStrings(node *yaml.Node) (string, string) {
+	if node.Kind != yaml.SequenceNode {
+		return problemError, "should be a list"
+	}
+	return "", ""
+}
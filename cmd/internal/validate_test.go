@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"testing"
+)
+
+func TestValidateConfigNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: `version: 1.1.0
+identities:
+  work:
+    idp: azure
+    azure_tenant_id: 8c3a2f51-7d1e-4b6a-9f0c-2e5d8a1b4c7f
+defaults:
+  team:
+    identity: work
+    region: eu-west-1
+configs:
+  prod:
+    defaults: team
+    destination_account_id: "123456789012"
+    default_duration_hours: 4
+account_aliases:
+  "123456789012": prod
+`,
+		},
+		{
+			name:    "not a mapping",
+			content: "- prod\n",
+			want:    []string{"error config: the config file should be a mapping"},
+		},
+		{
+			name: "unknown keys",
+			content: `version: 1.1.0
+config:
+  prod: {}
+configs:
+  prod:
+    regoin: eu-west-1
+    something_else: true
+`,
+			want: []string{
+				"warning config: unknown key config. did you mean configs?",
+				"warning configs.prod.regoin: unknown key regoin. did you mean region?",
+				"warning configs.prod.something_else: unknown key something_else",
+			},
+		},
+		{
+			name: "invalid values",
+			content: `version: 1.1.0
+configs:
+  prod:
+    idp: google
+    azure_tenant_id: contoso.com
+    azure_client_id: not-a-guid
+    destination_account_id: 123456789012
+    remember_me: sometimes
+`,
+			want: []string{
+				"error configs.prod.idp: google isn't one of azure, okta",
+				"warning configs.prod.azure_tenant_id: the tenant id is a domain. the GUID of the tenant is more reliable",
+				"error configs.prod.azure_client_id: not-a-guid isn't a GUID",
+				"warning configs.prod.destination_account_id: quote the account id, so it's read as text",
+				"error configs.prod.remember_me: sometimes should be true or false",
+			},
+		},
+		{
+			name: "blocks that don't exist",
+			content: `version: 1.1.0
+identities:
+  work:
+    idp: okta
+defaults:
+  team:
+    identity: personal
+    defaults: other
+configs:
+  prod:
+    identity: work
+    defaults: platform
+`,
+			want: []string{
+				"error defaults.team.identity: the identity personal doesn't exist",
+				"error defaults.team.defaults: defaults can't inherit from other defaults",
+				"error configs.prod.defaults: the defaults platform don't exist",
+			},
+		},
+		{
+			name: "profiles name defaults when there is no defaults block",
+			content: `version: 1.1.0
+configs:
+  prod:
+    defaults: team
+`,
+			want: []string{"error configs.prod.defaults: the defaults team don't exist"},
+		},
+		{
+			name: "blocks that aren't mappings",
+			content: `version: 1.1.0
+identities: work
+configs:
+  prod: eu-west-1
+  empty:
+account_aliases:
+  prod: "123456789012"
+`,
+			want: []string{
+				"error identities: should be a mapping",
+				"error configs.prod: should be a mapping",
+				"error account_aliases.prod: the account id should be 12 digits",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := yaml.Node{}
+			if err := yaml.Unmarshal([]byte(tt.content), &document); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, problem := range validateConfigNode(document.Content[0]) {
+				got = append(got, fmt.Sprintf("%s %s: %s", problem.severity, problem.path, problem.message))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfigNode() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const wizardBackInput = "<"
+
+const (
+	keepUnchangedOption = "(keep unchanged)"
+	otherOption         = "Other..."
+	noneOption          = "(none)"
+)
+
+var wizardBackError = errors.New("back")
+
+// wizardStep asks for one setting. Steps that don't apply to what was answered
+// before are skipped
+type wizardStep struct {
+	applies func(config *configuration) bool
+	ask     func(config *configuration) error
+}
+
+type configWizard struct {
+	prompter Prompter
+	// allowEmpty is set when the answers are merged into every profile, so an
+	// empty answer keeps the values of the profiles
+	allowEmpty bool
+}
+
+// askConfig walks the user through the settings of a profile, checking every
+// answer, and saves nothing until the user confirms the summary. Entering <
+// goes back to the previous question
+func askConfig(config configuration, allowEmpty bool) (*configuration, error) {
+	w := &configWizard{allowEmpty: allowEmpty}
+	steps := w.steps()
+
+	fmt.Println("Enter < to go back to the previous question")
+
+	var history []int
+	for i := 0; i < len(steps); {
+		if !steps[i].applies(&config) {
+			i++
+			continue
+		}
+
+		err := steps[i].ask(&config)
+		if errors.Is(err, wizardBackError) {
+			if len(history) > 0 {
+				i = history[len(history)-1]
+				history = history[:len(history)-1]
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, i)
+		i++
+
+		if i == len(steps) {
+			restart, err := w.confirm(&config)
+			if errors.Is(err, wizardBackError) {
+				i = history[len(history)-1]
+				history = history[:len(history)-1]
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if restart {
+				i = 0
+				history = nil
+			}
+		}
+	}
+
+	if allowEmpty && config.DefaultDurationHours == 0 {
+		config.DefaultDurationHours = -1
+	}
+
+	return &config, nil
+}
+
+func (w *configWizard) steps() []wizardStep {
+	always := func(config *configuration) bool { return true }
+	isOkta := func(config *configuration) bool { return config.Idp == idpOkta }
+	isAzure := func(config *configuration) bool { return config.Idp != idpOkta }
+	perProfile := func(config *configuration) bool { return !w.allowEmpty }
+
+	return []wizardStep{
+		{always, w.selectStep("idp", "Identity Provider", idpAzure, idpOkta)},
+		{isOkta, w.textStep("okta_app_url", "Okta App Url")},
+		{isOkta, w.textStep("okta_username", "Okta Username")},
+		{isAzure, w.textStep("azure_tenant_id", "Azure Tenant Id")},
+		{isAzure, w.textStep("azure_app_id_uri", "Azure App Id Uri")},
+		{isAzure, w.textStep("azure_username", "Azure Username")},
+		{isAzure, w.selectStep("auth_mode", "Auth Mode", authModeBrowser, authModeDeviceCode, authModeSystemBrowser)},
+		{
+			func(config *configuration) bool { return isAzure(config) && config.AuthMode == authModeDeviceCode },
+			w.textStep("azure_client_id", "Azure Client Id (its secret is set by an administrator in "+azureClientSecretEnv+")"),
+		},
+		{
+			func(config *configuration) bool { return isAzure(config) && config.AuthMode == authModeSystemBrowser },
+			w.optionalTextStep("loopback_url", "Loopback Url (empty to paste the SAML response)"),
+		},
+		{
+			func(config *configuration) bool {
+				return perProfile(config) && isAzure(config) && (config.AuthMode == "" || config.AuthMode == authModeBrowser)
+			},
+			w.rememberMeStep,
+		},
+		{perProfile, w.textStep("destination_account_id", "Destination Account Id")},
+		{perProfile, w.textStep("destination_role_name", "Destination Role Name")},
+		{always, w.jumpRoleStep},
+		{always, w.regionStep},
+		{always, w.textStep("default_duration_hours", "Default Duration (Hour)")},
+	}
+}
+
+// textStep asks for a value that's required, unless answers are merged into
+// every profile
+func (w *configWizard) textStep(key string, label string) func(config *configuration) error {
+	return w.text(key, label, w.allowEmpty)
+}
+
+func (w *configWizard) optionalTextStep(key string, label string) func(config *configuration) error {
+	return w.text(key, label, true)
+}
+
+func (w *configWizard) text(key string, label string, allowEmpty bool) func(config *configuration) error {
+	return func(config *configuration) error {
+		field, _ := configurationField(config, key)
+
+		defaultValue := ""
+		switch field.Kind() {
+		case reflect.String:
+			defaultValue = field.String()
+		case reflect.Int:
+			if field.Int() > 0 {
+				defaultValue = strconv.FormatInt(field.Int(), 10)
+			}
+		}
+
+		input, err := w.prompter.ValidatedPrompt(label, defaultValue, func(input string) error {
+			input = strings.TrimSpace(input)
+			if input == wizardBackInput {
+				return nil
+			}
+			if input == "" {
+				if allowEmpty {
+					return nil
+				}
+				return fmt.Errorf("%s is required", label)
+			}
+			return validateWizardInput(key, field.Kind(), input)
+		})
+		if err != nil {
+			return err
+		}
+
+		input = strings.TrimSpace(input)
+		if input == wizardBackInput {
+			return wizardBackError
+		}
+
+		return setWizardValue(field, input)
+	}
+}
+
+func (w *configWizard) selectStep(key string, label string, options ...string) func(config *configuration) error {
+	return func(config *configuration) error {
+		field, _ := configurationField(config, key)
+
+		value, err := w.selectOption(label, options, field.String())
+		if err != nil {
+			return err
+		}
+
+		if value != keepUnchangedOption {
+			field.SetString(value)
+		}
+		return nil
+	}
+}
+
+func (w *configWizard) rememberMeStep(config *configuration) error {
+	current := "No"
+	if config.RememberMe {
+		current = "Yes"
+	}
+
+	value, err := w.selectOption("Stay signed in to Azure between logins", []string{"Yes", "No"}, current)
+	if err != nil {
+		return err
+	}
+
+	config.RememberMe = value == "Yes"
+	return nil
+}
+
+// jumpRoleStep offers the roles of the last login with the identity, if any
+func (w *configWizard) jumpRoleStep(config *configuration) error {
+	roles := loadCachedRoles(config)
+	if len(roles) == 0 {
+		return w.optionalTextStep("default_jump_role", "Default Jump Role (empty to choose when logging in)")(config)
+	}
+
+	// The current role may not be among the cached ones, and is kept as the
+	// selected option so enter doesn't change it
+	if config.DefaultJumpRole != "" && !contains(roles, config.DefaultJumpRole) {
+		roles = append([]string{config.DefaultJumpRole}, roles...)
+	}
+
+	aliases := accountAliases()
+	var options []string
+	current := noneOption
+	for _, roleArn := range roles {
+		option := roleDisplayName(roleArn, aliases)
+		if option != roleArn {
+			option = fmt.Sprintf("%s [%s]", option, roleArn)
+		}
+		options = append(options, option)
+
+		if roleArn == config.DefaultJumpRole {
+			current = option
+		}
+	}
+	// Keeping the profiles unchanged is the empty answer when configuring all
+	// of them, so there's no role to clear
+	if !w.allowEmpty {
+		options = append(options, noneOption)
+	}
+	options = append(options, otherOption)
+
+	value, err := w.selectOption("Default Jump Role", options, current)
+	if err != nil {
+		return err
+	}
+
+	switch value {
+	case keepUnchangedOption:
+	case noneOption:
+		config.DefaultJumpRole = ""
+	case otherOption:
+		return w.optionalTextStep("default_jump_role", "Default Jump Role")(config)
+	default:
+		config.DefaultJumpRole = roles[indexOf(options, value)]
+	}
+	return nil
+}
+
+func (w *configWizard) regionStep(config *configuration) error {
+	current := config.Region
+	if current == "" && !w.allowEmpty {
+		current = "us-east-1"
+	}
+
+	options := append([]string{}, awsRegions...)
+	if current != "" && !contains(options, current) {
+		options = append([]string{current}, options...)
+	}
+	options = append(options, otherOption)
+
+	value, err := w.selectOption("Region", options, current)
+	if err != nil {
+		return err
+	}
+
+	switch value {
+	case keepUnchangedOption:
+	case otherOption:
+		return w.textStep("region", "Region")(config)
+	default:
+		config.Region = value
+	}
+	return nil
+}
+
+// selectOption shows the options with the cursor on current, and a back option.
+// When answers are merged into every profile, keeping the values is offered too
+func (w *configWizard) selectOption(label string, options []string, current string) (string, error) {
+	items := []string{}
+	if w.allowEmpty {
+		items = append(items, keepUnchangedOption)
+	}
+	items = append(items, options...)
+	items = append(items, "< Back")
+
+	cursor := indexOf(items, current)
+	if w.allowEmpty {
+		cursor = 0
+	}
+
+	index, value, err := w.prompter.SelectAt(label, items, cursor)
+	if err != nil {
+		return "", err
+	}
+	if index == len(items)-1 {
+		return "", wizardBackError
+	}
+	return value, nil
+}
+
+// confirm shows the answers and asks whether to save them. It returns true to
+// start over
+func (w *configWizard) confirm(config *configuration) (bool, error) {
+	summary := *config
+	if w.allowEmpty && summary.DefaultDurationHours < 0 {
+		summary.DefaultDurationHours = 0
+	}
+
+	content, err := yaml.Marshal(&summary)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Println()
+	if w.allowEmpty {
+		fmt.Println("These values will be set on every profile:")
+	} else {
+		fmt.Println("The profile will be saved with:")
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+
+	options := []string{"Save", "Change something", "Cancel", "< Back"}
+	index, _, err := w.prompter.Select("Save the configuration?", options, nil)
+	if err != nil {
+		return false, err
+	}
+
+	switch index {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	case 2:
+		return false, configCanceledError
+	default:
+		return false, wizardBackError
+	}
+}
+
+func validateWizardInput(key string, kind reflect.Kind, input string) error {
+	validator, ok := configValueValidators[key]
+	if !ok {
+		return nil
+	}
+
+	severity, message := validator(valueNode(kind, input))
+	if severity == problemError {
+		return errors.New(message)
+	}
+	return nil
+}
+
+func setWizardValue(field reflect.Value, input string) error {
+	switch field.Kind() {
+	case reflect.Int:
+		if input == "" {
+			field.SetInt(0)
+			return nil
+		}
+		value, err := strconv.Atoi(input)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(value))
+	default:
+		field.SetString(input)
+	}
+	return nil
+}
+
+func indexOf(items []string, item string) int {
+	for i, s := range items {
+		if s == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadCachedRoles returns the roles of the last login with the identity of the
+// config
+func loadCachedRoles(config *configuration) []string {
+	content, err := os.ReadFile(defaultCachedRolesLocation)
+	if err != nil {
+		return nil
+	}
+
+	file := cachedRolesFile{}
+	err = yaml.Unmarshal(content, &file)
+	if err != nil {
+		return nil
+	}
+	return file.Roles[config.Hash()]
+}
+
+func saveCachedRoles(config *configuration, roles []role) error {
+	file := cachedRolesFile{}
+	content, err := os.ReadFile(defaultCachedRolesLocation)
+	if err == nil {
+		_ = yaml.Unmarshal(content, &file)
+	}
+	if file.Roles == nil {
+		file.Roles = make(map[string][]string)
+	}
+
+	var roleArns []string
+	for _, r := range roles {
+		roleArns = append(roleArns, r.roleArn)
+	}
+	file.Roles[config.Hash()] = roleArns
+	file.Version = configFileVersion
+
+	err = os.MkdirAll(filepath.Dir(defaultCachedRolesLocation), 0755)
+	if err != nil {
+		return err
+	}
+
+	content, err = yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(defaultCachedRolesLocation, content, 0644)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+)
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Removes the saved browser sessions",
+	Long:  `Removes the saved browser sessions, so the next login starts from scratch. Without a profile, the sessions of all profiles are removed`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return err
+		}
+
+		return internal.Logout(profile, !cmd.Flags().Changed("profile"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// samlCmd represents the saml command
+var samlCmd = &cobra.Command{
+	Use:   "saml",
+	Short: "Tools for SAML responses",
+	Long:  `Tools for inspecting the SAML responses of the identity provider`,
+}
+
+func init() {
+	rootCmd.AddCommand(samlCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vahid-haghighat/awsure/cmd/internal"
+	"io"
+	"os"
+)
+
+var samlDecodePath string
+var samlDecodeOutput string
+var samlDecodeDump bool
+
+// samlDecodeCmd represents the saml decode command
+var samlDecodeCmd = &cobra.Command{
+	Use:   "decode",
+	Short: "Decodes a SAML response",
+	Long: `Decodes a SAML response and prints its issuer, subject, conditions, attributes and signing certificate.
+The response is read from the file, or from stdin when no file or - is given. It can be the base64 value posted to AWS or XML.
+With --dump-saml, a fresh response is fetched by logging in with the profile instead`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var saml string
+		if samlDecodeDump {
+			if samlDecodePath != "" {
+				return fmt.Errorf("--file and --dump-saml can't be used together")
+			}
+
+			var err error
+			saml, err = internal.FreshSaml(cmd.Context(), configuration.Profile, configuration)
+			if err != nil {
+				return err
+			}
+		} else {
+			content, err := readSamlInput(samlDecodePath)
+			if err != nil {
+				return err
+			}
+			saml = string(content)
+		}
+
+		return internal.SamlDecode(saml, samlDecodeOutput)
+	},
+}
+
+func readSamlInput(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	path, err := absolutePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func init() {
+	samlDecodeCmd.Flags().StringVarP(&samlDecodePath, "file", "f", "", "The file to read the SAML response from. Reads stdin when empty or -")
+	samlDecodeCmd.Flags().StringVarP(&samlDecodeOutput, "output", "o", "text", "The output format, text or json")
+	samlDecodeCmd.Flags().BoolVar(&samlDecodeDump, "dump-saml", false, "Log in with the profile and decode the fresh SAML response")
+	samlCmd.AddCommand(samlDecodeCmd)
+}
@@ -1,6 +1,26 @@
 package types
 
+import "time"
+
 type Configuration struct {
-	Profile string
-	Visible bool
+	Profile      string
+	Visible      bool
+	Timeout      time.Duration
+	StateTimeout time.Duration
+	AuthMode     string
+	BrowserUrl   string
+	BrowserPath  string
+	BrowserArgs  []string
+	NoSandbox    bool
+	Proxy        string
+	CaBundle     string
+	ProfileFlags []ProfileFlag
+}
+
+// ProfileFlag is a value of the profile given on the command line, which takes
+// precedence over the config file and the environment
+type ProfileFlag struct {
+	Name  string
+	Key   string
+	Value string
 }
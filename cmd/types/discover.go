@@ -0,0 +1,8 @@
+package types
+
+type DiscoverOptions struct {
+	NameTemplate string
+	Organization bool
+	RoleName     string
+	Overwrite    bool
+}
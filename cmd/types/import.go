@@ -0,0 +1,21 @@
+package types
+
+type ImportOptions struct {
+	// Merge is the strategy for values that differ between the files. The
+	// config file is replaced when it's empty
+	Merge    string
+	DryRun   bool
+	Profiles []string
+	// Format is the tool the file is from. Empty for awsure's own
+	Format string
+}
+
+type ExportOptions struct {
+	Format string
+	// Share leaves out personal values, with placeholders that importing
+	// asks for
+	Share    bool
+	Profiles []string
+	// Force updates an existing file of another tool, after backing it up
+	Force bool
+}